@@ -18,8 +18,12 @@ package v1
 
 import (
 	appsV1 "k8s.io/api/apps/v1"
+	autoscalingV2 "k8s.io/api/autoscaling/v2"
 	coreV1 "k8s.io/api/core/v1"
+	networkingV1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // 权限配置，如果更新需要重新执行 make manifests
@@ -47,11 +51,36 @@ type NginxStatus struct {
 	// PodSelector is the Nginx pod label selector.
 	PodSelector string `json:"podSelector,omitempty"`
 
-	Deployments []DeploymentStatus `json:"deployments,omitempty"`
-	Services    []ServiceStatus    `json:"services,omitempty"`
-	Ingresses   []IngressStatus    `json:"ingresses,omitempty"`
+	Deployments  []DeploymentStatus  `json:"deployments,omitempty"`
+	DaemonSets   []DaemonSetStatus   `json:"daemonSets,omitempty"`
+	StatefulSets []StatefulSetStatus `json:"statefulSets,omitempty"`
+	Services     []ServiceStatus     `json:"services,omitempty"`
+	Ingresses    []IngressStatus     `json:"ingresses,omitempty"`
+
+	// Content 静态文件同步状态.
+	// +optional
+	Content *ContentStatus `json:"content,omitempty"`
+
+	// WAF Web 应用防火墙生效状态.
+	// +optional
+	WAF *WAFStatus `json:"waf,omitempty"`
+
+	// Conditions represent the latest available observations of the Nginx state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metaV1.Condition `json:"conditions,omitempty"`
 }
 
+const (
+	// ConditionTypeReady 所有期望的 nginx Pod 均已就绪
+	ConditionTypeReady = "Ready"
+	// ConditionTypePodSecurityCompliant nginx Pod 模板满足命名空间 enforce 的 Pod Security Standards 级别
+	ConditionTypePodSecurityCompliant = "PodSecurityCompliant"
+	// ConditionTypeGeneratedConfigIncluded ConfigMap 类型的配置引用了 operator 生成的配置片段
+	ConditionTypeGeneratedConfigIncluded = "GeneratedConfigIncluded"
+)
+
 //+kubebuilder:object:root=true
 
 // NginxList contains a list of Nginx
@@ -72,6 +101,18 @@ const (
 	Kind             = "Nginx"
 )
 
+// WorkloadKind 运行 nginx Pod 的工作负载类型
+type WorkloadKind string
+
+const (
+	// WorkloadKindDeployment 使用 Deployment 运行 nginx, 默认值
+	WorkloadKindDeployment = WorkloadKind("Deployment")
+	// WorkloadKindDaemonSet 使用 DaemonSet 在每个节点上运行一个 nginx, 适用于边缘节点/hostNetwork
+	WorkloadKindDaemonSet = WorkloadKind("DaemonSet")
+	// WorkloadKindStatefulSet 使用 StatefulSet 运行 nginx, 每个 Pod 拥有独立的持久化缓存卷
+	WorkloadKindStatefulSet = WorkloadKind("StatefulSet")
+)
+
 type NginxIngress struct {
 	// Annotations are extra annotations for the Ingress resource.
 	// +optional
@@ -79,9 +120,100 @@ type NginxIngress struct {
 	// Labels are extra labels for the Ingress resource.
 	// +optional
 	Labels map[string]string `json:"labels,omitempty"`
-	// IngressClassName is the class to be set on Ingress.
+	// IngressClassName is the class to be set on Ingress. Defaults to the
+	// class of the selected profile.
 	// +optional
 	IngressClassName *string `json:"ingressClassName,omitempty"`
+	// Profile is the ingress controller the features are translated for.
+	// Defaults to "ingress-nginx".
+	// +kubebuilder:validation:Enum=ingress-nginx;traefik;haproxy;aws-alb
+	// +optional
+	Profile IngressProfile `json:"profile,omitempty"`
+	// Features are controller-agnostic ingress options, translated into the
+	// annotations (or objects) of the selected profile. Annotations set
+	// explicitly in Annotations take precedence.
+	// +optional
+	Features *NginxIngressFeatures `json:"features,omitempty"`
+}
+
+// IngressProfile 处理 Ingress 的控制器类型, 决定 features 翻译成哪种注解
+type IngressProfile string
+
+const (
+	// IngressProfileIngressNginx kubernetes/ingress-nginx, 默认值
+	IngressProfileIngressNginx = IngressProfile("ingress-nginx")
+	// IngressProfileTraefik Traefik v3, 部分功能通过 Middleware 实现
+	IngressProfileTraefik = IngressProfile("traefik")
+	// IngressProfileHAProxy jcmoraisjr/haproxy-ingress
+	IngressProfileHAProxy = IngressProfile("haproxy")
+	// IngressProfileAWSALB AWS Load Balancer Controller
+	IngressProfileAWSALB = IngressProfile("aws-alb")
+)
+
+type NginxIngressFeatures struct {
+	// ProxyBodySize is the maximum allowed size of the client request body.
+	// +optional
+	ProxyBodySize *resource.Quantity `json:"proxyBodySize,omitempty"`
+	// Timeouts are the timeouts used when proxying to nginx.
+	// +optional
+	Timeouts *NginxIngressTimeouts `json:"timeouts,omitempty"`
+	// SSLRedirect redirects HTTP requests to HTTPS when true.
+	// +optional
+	SSLRedirect *bool `json:"sslRedirect,omitempty"`
+	// CORS enables cross-origin resource sharing.
+	// +optional
+	CORS *NginxIngressCORS `json:"cors,omitempty"`
+	// RateLimit limits the requests per second of each client IP.
+	// +optional
+	RateLimit *NginxIngressRateLimit `json:"rateLimit,omitempty"`
+	// WhitelistSourceRange are the client CIDRs allowed to access the Ingress.
+	// +optional
+	WhitelistSourceRange []string `json:"whitelistSourceRange,omitempty"`
+	// BackendProtocol is the protocol used to talk to nginx.
+	// +kubebuilder:validation:Enum=HTTP;HTTPS;GRPC;GRPCS
+	// +optional
+	BackendProtocol string `json:"backendProtocol,omitempty"`
+}
+
+type NginxIngressTimeouts struct {
+	// Connect is the timeout for establishing a connection with nginx.
+	// +optional
+	Connect *metaV1.Duration `json:"connect,omitempty"`
+	// Read is the timeout for reading a response from nginx.
+	// +optional
+	Read *metaV1.Duration `json:"read,omitempty"`
+	// Send is the timeout for sending a request to nginx.
+	// +optional
+	Send *metaV1.Duration `json:"send,omitempty"`
+}
+
+type NginxIngressCORS struct {
+	// AllowOrigins are the allowed origins. Defaults to "*".
+	// +optional
+	AllowOrigins []string `json:"allowOrigins,omitempty"`
+	// AllowMethods are the allowed methods.
+	// +optional
+	AllowMethods []string `json:"allowMethods,omitempty"`
+	// AllowHeaders are the allowed request headers.
+	// +optional
+	AllowHeaders []string `json:"allowHeaders,omitempty"`
+	// AllowCredentials allows credentials in cross-origin requests.
+	// +optional
+	AllowCredentials bool `json:"allowCredentials,omitempty"`
+	// MaxAge is how long, in seconds, preflight responses may be cached.
+	// +optional
+	MaxAge *int32 `json:"maxAge,omitempty"`
+}
+
+type NginxIngressRateLimit struct {
+	// RequestsPerSecond is the average number of requests per second allowed
+	// for each client IP.
+	// +kubebuilder:validation:Minimum=1
+	RequestsPerSecond int32 `json:"requestsPerSecond"`
+	// Burst is the number of requests allowed above the rate. Defaults to
+	// the profile's default.
+	// +optional
+	Burst *int32 `json:"burst,omitempty"`
 }
 
 type NginxTLS struct {
@@ -121,6 +253,17 @@ type NginxService struct {
 	UsePodSelector *bool `json:"usePodSelector,omitempty"`
 }
 
+// NginxNamedService 使用名称后缀区分同一 Nginx 实例的多个 Service
+type NginxNamedService struct {
+	// NameSuffix Service 名称后缀, Service 名称为 "<nginx 名称>-<nameSuffix>".
+	// 后缀 "service" 即默认 Service, Ingress 优先使用该 Service 作为后端.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=32
+	NameSuffix string `json:"nameSuffix"`
+
+	NginxService `json:",inline"`
+}
+
 type PodTemplateSpec struct {
 	// Affinity to be set on the nginx pod.
 	// +optional
@@ -171,6 +314,525 @@ type PodTemplateSpec struct {
 	// ServiceAccountName is the name of the ServiceAccount to use to run this nginx instance.
 	// +optional
 	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// Env is the list of environment variables to set in the nginx container.
+	// +optional
+	Env []coreV1.EnvVar `json:"env,omitempty"`
+	// EnvFrom is the list of sources to populate environment variables in the nginx container.
+	// +optional
+	EnvFrom []coreV1.EnvFromSource `json:"envFrom,omitempty"`
+	// Lifecycle 是 nginx 容器的生命周期钩子, 例如 preStop.
+	// +optional
+	Lifecycle *coreV1.Lifecycle `json:"lifecycle,omitempty"`
+	// ImagePullSecrets 拉取私有仓库镜像使用的 Secret.
+	// +optional
+	ImagePullSecrets []coreV1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	// PriorityClassName is the priority class of the nginx pod.
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// TopologySpreadConstraints describes how the nginx pods ought to spread across
+	// topology domains. A constraint without labelSelector selects the nginx pods.
+	// +optional
+	TopologySpreadConstraints []coreV1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	// DNSPolicy is the DNS policy of the nginx pod. Defaults to "ClusterFirst".
+	// +optional
+	DNSPolicy coreV1.DNSPolicy `json:"dnsPolicy,omitempty"`
+	// DNSConfig specifies the DNS parameters of the nginx pod.
+	// +optional
+	DNSConfig *coreV1.PodDNSConfig `json:"dnsConfig,omitempty"`
+	// PodSecurityContext holds pod-level security attributes, SecurityContext
+	// above only applies to the nginx container.
+	// +optional
+	PodSecurityContext *coreV1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	// RuntimeClassName is the RuntimeClass used to run the nginx pod.
+	// +optional
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+	// HostAliases are entries added to the pod's hosts file.
+	// +optional
+	HostAliases []coreV1.HostAlias `json:"hostAliases,omitempty"`
+	// Unprivileged 以非 root 用户运行 nginx, 满足 restricted Pod Security Standard:
+	// 默认镜像切换为 nginx-unprivileged, 容器端口默认为 8080/8443(Service 端口仍为 80/443),
+	// 只读根文件系统, 删除所有 capabilities, 使用 RuntimeDefault seccomp profile.
+	// 自定义配置需要监听 8080/8443.
+	// +optional
+	Unprivileged bool `json:"unprivileged,omitempty"`
+	// GracefulShutdown 优雅退出配置, 开启后注入 preStop 钩子, 等待 endpoint 摘除后执行 "nginx -s quit".
+	// 与 Lifecycle.PreStop 互斥.
+	// +optional
+	GracefulShutdown *NginxGracefulShutdown `json:"gracefulShutdown,omitempty"`
+}
+
+// NginxGracefulShutdown 优雅退出配置
+type NginxGracefulShutdown struct {
+	// Enabled 是否开启优雅退出.
+	Enabled bool `json:"enabled"`
+	// DrainSeconds preStop 中等待 Service endpoint 摘除的时间, 之后才停止接收新连接. Defaults to 5.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	DrainSeconds *int32 `json:"drainSeconds,omitempty"`
+	// QuitTimeoutSeconds 执行 "nginx -s quit" 后等待已有连接处理完成的最长时间,
+	// TerminationGracePeriodSeconds 至少为 DrainSeconds + QuitTimeoutSeconds. Defaults to 30.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	QuitTimeoutSeconds *int32 `json:"quitTimeoutSeconds,omitempty"`
+	// MinReadySeconds 新 Pod 就绪后需要稳定运行的时间, 之后才会继续替换旧 Pod. Defaults to 10.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinReadySeconds *int32 `json:"minReadySeconds,omitempty"`
+}
+
+// NginxAutoscaling configures the HorizontalPodAutoscaler managed for the nginx pods.
+type NginxAutoscaling struct {
+	// MinReplicas is the lower limit for the number of replicas. Defaults to 1.
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// MaxReplicas is the upper limit for the number of replicas.
+	MaxReplicas int32 `json:"maxReplicas"`
+	// TargetCPUUtilizationPercentage is the target average CPU utilization over
+	// all the pods, represented as a percentage of the requested CPU.
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+	// TargetMemoryUtilizationPercentage is the target average memory utilization
+	// over all the pods, represented as a percentage of the requested memory.
+	// +optional
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+	// Metrics are extra custom or external metrics used to calculate the desired
+	// replica count, e.g. requests per second exported from nginx stub_status.
+	// +optional
+	Metrics []autoscalingV2.MetricSpec `json:"metrics,omitempty"`
+	// Behavior configures the scaling behavior in both Up and Down directions.
+	// +optional
+	Behavior *autoscalingV2.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
+}
+
+type ProbeType string
+
+const (
+	ProbeTypeHTTP  = ProbeType("http")
+	ProbeTypeHTTPS = ProbeType("https")
+	ProbeTypeTCP   = ProbeType("tcp")
+	// ProbeTypeExec 在容器中执行命令, 未配置命令时使用 curl 检查 http 端口,
+	// 配置了 TLS 时同时检查 https 端口(适用于在 Pod 中终止 TLS 的实例).
+	ProbeTypeExec = ProbeType("exec")
+)
+
+// NginxProbes nginx 容器的健康检查配置
+type NginxProbes struct {
+	// Readiness 就绪检查, 未配置时使用 http 检查 HealthcheckPath.
+	// +optional
+	Readiness *NginxProbe `json:"readiness,omitempty"`
+	// Liveness 存活检查, 未配置时不检查; 配置后类型默认为 tcp.
+	// +optional
+	Liveness *NginxProbe `json:"liveness,omitempty"`
+	// Startup 启动检查, 未配置时不检查; 配置后类型默认为 http.
+	// +optional
+	Startup *NginxProbe `json:"startup,omitempty"`
+}
+
+// NginxProbe 健康检查, 未设置的字段使用默认值
+type NginxProbe struct {
+	// Type 检查类型, 可选值 "http", "https", "tcp" 或 "exec".
+	// +kubebuilder:validation:Enum=http;https;tcp;exec
+	// +optional
+	Type ProbeType `json:"type,omitempty"`
+	// Path http/https 检查的路径. Defaults to HealthcheckPath.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Port http/https/tcp 检查的端口号或端口名称. Defaults to the http (or https) container port.
+	// +optional
+	Port *intstr.IntOrString `json:"port,omitempty"`
+	// Command exec 检查执行的命令.
+	// +optional
+	Command []string `json:"command,omitempty"`
+	// InitialDelaySeconds 容器启动后延迟多少秒开始检查.
+	// +optional
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+	// TimeoutSeconds 检查超时时间.
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+	// PeriodSeconds 检查间隔.
+	// +optional
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+	// SuccessThreshold 失败后连续成功多少次视为成功, liveness 和 startup 只能为 1.
+	// +optional
+	SuccessThreshold *int32 `json:"successThreshold,omitempty"`
+	// FailureThreshold 连续失败多少次视为失败.
+	// +optional
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+}
+
+// Enforcement 执行认证, 限流等访问控制的位置
+type Enforcement string
+
+const (
+	// EnforcementNginx 在 nginx 生成的配置中执行, 默认值
+	EnforcementNginx = Enforcement("Nginx")
+	// EnforcementIngress 由 ingress 控制器执行, 需要配置 spec.ingress
+	EnforcementIngress = Enforcement("Ingress")
+)
+
+// NginxAuth 访问认证配置
+type NginxAuth struct {
+	// Basic HTTP basic 认证, 与 oidc 互斥.
+	// +optional
+	Basic *NginxBasicAuth `json:"basic,omitempty"`
+	// OIDC 使用 oauth2-proxy sidecar 进行 OpenID Connect 单点登录.
+	// +optional
+	OIDC *NginxOIDCAuth `json:"oidc,omitempty"`
+}
+
+// NginxOIDCAuth operator 在 nginx Pod 中运行 oauth2-proxy, 由 nginx auth_request 或 ingress 控制器调用其 /oauth2/auth 接口
+type NginxOIDCAuth struct {
+	// IssuerURL OIDC 提供方地址, 例如 "https://accounts.google.com".
+	// +kubebuilder:validation:Pattern=`^https://`
+	IssuerURL string `json:"issuerURL"`
+	// ClientID OIDC 客户端 ID.
+	ClientID string `json:"clientID"`
+	// ClientSecretName 包含 "client-secret" 和 "cookie-secret"(16, 24 或 32 字节) 的 Secret.
+	ClientSecretName string `json:"clientSecretName"`
+	// EmailDomains 允许登录的邮箱域名, 为空时允许所有域名.
+	// +optional
+	EmailDomains []string `json:"emailDomains,omitempty"`
+	// Groups 允许登录的用户组, 为空时不限制.
+	// +optional
+	Groups []string `json:"groups,omitempty"`
+	// Paths 需要认证的路径前缀, 为空时保护所有路径; 健康检查路径始终不需要认证.
+	// 只在 nginx 中认证时支持.
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+	// EnforcedBy 执行认证的位置. Defaults to "Nginx".
+	// +kubebuilder:validation:Enum=Nginx;Ingress
+	// +optional
+	EnforcedBy Enforcement `json:"enforcedBy,omitempty"`
+	// Image oauth2-proxy 镜像. Defaults to "quay.io/oauth2-proxy/oauth2-proxy:v7.5.1".
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Resources oauth2-proxy 容器的资源限制.
+	// +optional
+	Resources coreV1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// NginxBasicAuth operator 读取 SecretName 中的用户, 生成 htpasswd 文件保存在 "<name>-basic-auth" Secret 中
+type NginxBasicAuth struct {
+	// SecretName 用户所在的 Secret: 包含 "auth" 或 "htpasswd" 键时作为 htpasswd 文件直接使用,
+	// 否则每个键是用户名, 值是明文密码, 由 operator 计算哈希.
+	SecretName string `json:"secretName"`
+	// Realm 认证提示. Defaults to "Restricted".
+	// +optional
+	Realm string `json:"realm,omitempty"`
+	// Paths 需要认证的路径前缀, 为空时保护所有路径; 健康检查路径始终不需要认证.
+	// 只在 nginx 中认证时支持.
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+	// EnforcedBy 执行认证的位置. Defaults to "Nginx".
+	// +kubebuilder:validation:Enum=Nginx;Ingress
+	// +optional
+	EnforcedBy Enforcement `json:"enforcedBy,omitempty"`
+}
+
+// NginxErrorPage 使用 ConfigMap 中的内容替换 nginx 默认的错误页面
+type NginxErrorPage struct {
+	// Code HTTP 状态码.
+	// +kubebuilder:validation:Minimum=400
+	// +kubebuilder:validation:Maximum=599
+	Code int32 `json:"code"`
+	// ConfigMapName 保存页面内容的 ConfigMap, 与 Nginx 位于同一命名空间.
+	ConfigMapName string `json:"configMapName"`
+	// Key 页面内容在 ConfigMap 中的键.
+	Key string `json:"key"`
+}
+
+// NginxMaintenance 维护模式, 开启后除健康检查和允许的客户端外所有请求返回 503
+type NginxMaintenance struct {
+	// Enabled 开启维护模式. kubelet 同步 ConfigMap 后生效, 不会滚动更新 Pod.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// RetryAfter 维护期间 Retry-After 响应头的值. Defaults to 300s.
+	// +optional
+	RetryAfter *metaV1.Duration `json:"retryAfter,omitempty"`
+	// AllowedSourceRanges 维护期间仍可正常访问的客户端 IP 或 CIDR.
+	// +optional
+	AllowedSourceRanges []string `json:"allowedSourceRanges,omitempty"`
+}
+
+// WAFMode ModSecurity 的运行模式
+type WAFMode string
+
+const (
+	// WAFModeOff 关闭 WAF, 保留其余配置便于临时切换
+	WAFModeOff = WAFMode("Off")
+	// WAFModeDetection 只记录命中规则的请求, 不拦截, 默认值
+	WAFModeDetection = WAFMode("Detection")
+	// WAFModeBlocking 拦截异常分数超过阈值的请求, 返回 403
+	WAFModeBlocking = WAFMode("Blocking")
+)
+
+// NginxWAF 使用 ModSecurity 和 OWASP Core Rule Set 保护 nginx
+type NginxWAF struct {
+	// Mode WAF 运行模式. Defaults to "Detection".
+	// +kubebuilder:validation:Enum=Off;Detection;Blocking
+	// +optional
+	Mode WAFMode `json:"mode,omitempty"`
+	// ParanoiaLevel CRS 的 paranoia level, 级别越高规则越严格, 误报也越多. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=4
+	// +optional
+	ParanoiaLevel int32 `json:"paranoiaLevel,omitempty"`
+	// Exclusions 关闭误报的规则.
+	// +kubebuilder:validation:MaxItems=100
+	// +optional
+	Exclusions []NginxWAFExclusion `json:"exclusions,omitempty"`
+	// Image 编译了 ModSecurity 模块并内置 CRS 的 nginx 镜像, 开启 WAF 时替换 spec.image.
+	// Defaults to "owasp/modsecurity-crs:nginx-alpine".
+	// +optional
+	Image string `json:"image,omitempty"`
+	// RulesPath 镜像中 CRS 的目录, 需要包含 rules 子目录. Defaults to "/opt/owasp-crs".
+	// +optional
+	RulesPath string `json:"rulesPath,omitempty"`
+}
+
+// NginxWAFExclusion 关闭指定的 CRS 规则
+type NginxWAFExclusion struct {
+	// RuleIDs 关闭的规则 ID.
+	// +kubebuilder:validation:MinItems=1
+	RuleIDs []int32 `json:"ruleIDs"`
+	// Paths 只在这些路径前缀下关闭规则, 为空时全局关闭.
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+}
+
+// RateLimitKey 限流的统计维度
+type RateLimitKey string
+
+const (
+	// RateLimitKeyClientIP 按客户端 IP 限流, 默认值
+	RateLimitKeyClientIP = RateLimitKey("ClientIP")
+	// RateLimitKeyHeader 按请求头的值限流, 例如 API key, 不带该请求头的请求不限流
+	RateLimitKeyHeader = RateLimitKey("Header")
+)
+
+// NginxRateLimit 渲染为 limit_req_zone 和 limit_req, 超过限制的请求返回 429
+type NginxRateLimit struct {
+	// Name 限流名称, 用作 nginx 共享内存区域名称.
+	// +kubebuilder:validation:Pattern=`^[a-z][a-z0-9_]*$`
+	// +kubebuilder:validation:MaxLength=32
+	Name string `json:"name"`
+	// Key 限流的统计维度. Defaults to "ClientIP".
+	// +kubebuilder:validation:Enum=ClientIP;Header
+	// +optional
+	Key RateLimitKey `json:"key,omitempty"`
+	// Header key 为 Header 时使用的请求头名称.
+	// +optional
+	Header string `json:"header,omitempty"`
+	// Rate 平均速率, 例如 "10r/s" 或 "300r/m".
+	// +kubebuilder:validation:Pattern=`^[1-9][0-9]*r/[sm]$`
+	Rate string `json:"rate"`
+	// Burst 允许突发的请求数.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Burst int32 `json:"burst,omitempty"`
+	// NoDelay 突发请求不排队, 立即处理.
+	// +optional
+	NoDelay bool `json:"noDelay,omitempty"`
+	// ZoneSize 共享内存区域大小. Defaults to 10Mi.
+	// +optional
+	ZoneSize *resource.Quantity `json:"zoneSize,omitempty"`
+	// Paths 限流的路径前缀, 为空时作用于所有路径; 健康检查路径不限流. 只在 nginx 中限流时支持.
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+	// EnforcedBy 执行限流的位置. Defaults to "Nginx".
+	// +kubebuilder:validation:Enum=Nginx;Ingress
+	// +optional
+	EnforcedBy Enforcement `json:"enforcedBy,omitempty"`
+}
+
+// NginxConnectionLimits 渲染为 limit_conn_zone 和 limit_conn, 限制每个客户端 IP 的并发连接数
+type NginxConnectionLimits struct {
+	// PerClient 每个客户端 IP 允许的并发连接数.
+	// +kubebuilder:validation:Minimum=1
+	PerClient int32 `json:"perClient"`
+	// ZoneSize 共享内存区域大小. Defaults to 10Mi.
+	// +optional
+	ZoneSize *resource.Quantity `json:"zoneSize,omitempty"`
+	// EnforcedBy 执行限制的位置. Defaults to "Nginx".
+	// +kubebuilder:validation:Enum=Nginx;Ingress
+	// +optional
+	EnforcedBy Enforcement `json:"enforcedBy,omitempty"`
+}
+
+// NginxContent 静态文件来源, operator 在 nginx 启动前准备好 web 根目录
+type NginxContent struct {
+	// WebRoot nginx 的 web 根目录, 需要与配置中的 root 一致. Defaults to "/usr/share/nginx/html".
+	// operator 在其父目录挂载 emptyDir, 在 nginx 启动前准备好 WebRoot.
+	// +optional
+	WebRoot string `json:"webRoot,omitempty"`
+	// Git 使用 git-sync 从 Git 仓库同步内容, 与 archive, image 互斥.
+	// +optional
+	Git *NginxContentGit `json:"git,omitempty"`
+	// Archive 从 HTTP(S) 下载 tar 包并解压到 web 根目录.
+	// +optional
+	Archive *NginxContentArchive `json:"archive,omitempty"`
+	// Image 从 OCI 镜像中复制文件到 web 根目录.
+	// +optional
+	Image *NginxContentImage `json:"image,omitempty"`
+}
+
+// NginxContentArchive tar 包(支持 gzip)在 init 容器中下载, 校验和不匹配时 Pod 无法启动
+type NginxContentArchive struct {
+	// URL tar 包地址.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	URL string `json:"url"`
+	// SHA256 tar 包的 sha256 校验和, 修改后触发滚动更新.
+	// +kubebuilder:validation:Pattern=`^[a-f0-9]{64}$`
+	SHA256 string `json:"sha256"`
+	// StripComponents 解压时去掉的路径层级, 与 tar --strip-components 相同.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	StripComponents int32 `json:"stripComponents,omitempty"`
+	// DownloaderImage 执行下载的镜像, 需要包含 wget, sha256sum 和 tar. Defaults to "alpine:3.19".
+	// +optional
+	DownloaderImage string `json:"downloaderImage,omitempty"`
+}
+
+// NginxContentImage 以内容镜像作为 init 容器运行 cp, 镜像中需要包含 cp 命令(例如基于 busybox 构建)
+type NginxContentImage struct {
+	// Reference 镜像地址, 建议使用 digest 固定版本, 修改后触发滚动更新.
+	Reference string `json:"reference"`
+	// Path 镜像中静态文件所在目录. Defaults to "/usr/share/nginx/html".
+	// +optional
+	Path string `json:"path,omitempty"`
+	// ImagePullPolicy 内容镜像的拉取策略.
+	// +optional
+	ImagePullPolicy coreV1.PullPolicy `json:"imagePullPolicy,omitempty"`
+}
+
+// NginxContentGit 使用 git-sync init 容器完成首次同步, sidecar 容器持续同步
+type NginxContentGit struct {
+	// Repository Git 仓库地址, 例如 "https://github.com/org/docs.git" 或 "git@github.com:org/docs.git".
+	Repository string `json:"repository"`
+	// Ref 分支, tag 或 commit. Defaults to "HEAD".
+	// +optional
+	Ref string `json:"ref,omitempty"`
+	// Path 仓库中作为 web 根目录的子目录, 为空时使用仓库根目录.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// PollInterval 同步间隔. Defaults to 60s.
+	// +optional
+	PollInterval *metaV1.Duration `json:"pollInterval,omitempty"`
+	// AuthSecretName 认证使用的 Secret: https 仓库使用 "username" 和 "password",
+	// ssh 仓库使用 "ssh-privatekey" 和 "known_hosts".
+	// +optional
+	AuthSecretName string `json:"authSecretName,omitempty"`
+	// Image git-sync 镜像. Defaults to "registry.k8s.io/git-sync/git-sync:v4.2.1".
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Resources git-sync 容器的资源限制.
+	// +optional
+	Resources coreV1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// NginxNetworkPolicy 配置选择 nginx Pod 的 NetworkPolicy.
+type NginxNetworkPolicy struct {
+	// Enabled 是否创建 NetworkPolicy, 开启后只允许下面列出的来源访问 nginx 端口.
+	Enabled bool `json:"enabled"`
+	// IngressControllerNamespace 快捷配置, 允许该命名空间(通常是 ingress 控制器所在的命名空间)
+	// 中的所有 Pod 访问 nginx.
+	// +optional
+	IngressControllerNamespace string `json:"ingressControllerNamespace,omitempty"`
+	// From 允许访问 nginx 的来源, 与 IngressControllerNamespace 均未配置时拒绝所有入站流量.
+	// +optional
+	From []NginxNetworkPolicyPeer `json:"from,omitempty"`
+	// Egress 允许 nginx 访问的上游, 未配置时不限制出站流量;
+	// 配置后自动允许访问 DNS(53 端口).
+	// +optional
+	Egress []NginxNetworkPolicyUpstream `json:"egress,omitempty"`
+}
+
+// NginxNetworkPolicyPeer 网络策略的对端, CIDR 与 selector 互斥.
+type NginxNetworkPolicyPeer struct {
+	// NamespaceSelector 选择命名空间, 与 PodSelector 同时配置时表示这些命名空间中匹配的 Pod.
+	// +optional
+	NamespaceSelector *metaV1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// PodSelector 选择 Pod, 未配置 NamespaceSelector 时只匹配 nginx 所在命名空间的 Pod.
+	// +optional
+	PodSelector *metaV1.LabelSelector `json:"podSelector,omitempty"`
+	// CIDR 允许的 IP 段, 例如 "10.0.0.0/8".
+	// +optional
+	CIDR string `json:"cidr,omitempty"`
+	// Except 从 CIDR 中排除的 IP 段.
+	// +optional
+	Except []string `json:"except,omitempty"`
+}
+
+// NginxNetworkPolicyUpstream nginx 允许访问的上游.
+type NginxNetworkPolicyUpstream struct {
+	// To 上游地址, 为空时允许所有地址.
+	// +optional
+	To []NginxNetworkPolicyPeer `json:"to,omitempty"`
+	// Ports 上游端口, 为空时允许所有端口.
+	// +optional
+	Ports []networkingV1.NetworkPolicyPort `json:"ports,omitempty"`
+}
+
+// NginxCache 缓存卷配置, 用于 proxy_cache_path 等需要持久化的缓存目录.
+type NginxCache struct {
+	// Path 缓存卷在 nginx 容器中的挂载路径, 需要与 proxy_cache_path 保持一致.
+	// Defaults to "/var/cache/nginx".
+	// +optional
+	Path string `json:"path,omitempty"`
+	// VolumeClaimTemplate 缓存卷的 PVC 模板, 仅在 StatefulSet 模式下生效,
+	// 其他模式下使用 emptyDir.
+	// +optional
+	VolumeClaimTemplate NginxCacheVolumeClaimTemplate `json:"volumeClaimTemplate,omitempty"`
+}
+
+type NginxCacheVolumeClaimTemplate struct {
+	// Size 缓存卷大小. Defaults to "1Gi".
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+	// StorageClassName is the name of the StorageClass required by the claim.
+	// Defaults to the cluster default StorageClass.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+	// AccessModes contains the desired access modes the volume should have.
+	// Defaults to ["ReadWriteOnce"].
+	// +optional
+	AccessModes []coreV1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+}
+
+// NginxMonitoring 监控配置, 开启后 operator 会打开 nginx stub_status 并注入
+// nginx-prometheus-exporter sidecar.
+type NginxMonitoring struct {
+	// Enabled 是否开启监控.
+	Enabled bool `json:"enabled"`
+	// Image is the nginx-prometheus-exporter container image.
+	// Defaults to "nginx/nginx-prometheus-exporter:0.11.0".
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Port 是 exporter 暴露 metrics 的端口, Service 上同样使用该端口. Defaults to 9113.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+	// StubStatusPort 是 nginx 在 Pod 内部提供 stub_status 的端口, 仅允许本地访问.
+	// Defaults to 8090.
+	// +optional
+	StubStatusPort int32 `json:"stubStatusPort,omitempty"`
+	// Resources 是 exporter 容器的资源限制.
+	// +optional
+	Resources coreV1.ResourceRequirements `json:"resources,omitempty"`
+	// ServiceMonitor 配置 Prometheus Operator 的 ServiceMonitor,
+	// 集群中没有安装 ServiceMonitor CRD 时忽略.
+	// +optional
+	ServiceMonitor *NginxServiceMonitor `json:"serviceMonitor,omitempty"`
+}
+
+type NginxServiceMonitor struct {
+	// Interval at which metrics should be scraped, e.g. "30s".
+	// Defaults to the Prometheus global scrape interval.
+	// +optional
+	Interval string `json:"interval,omitempty"`
+	// Labels are extra labels for the ServiceMonitor, usually used by the
+	// Prometheus serviceMonitorSelector.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // ConfigRef is a reference to a config object.
@@ -196,11 +858,19 @@ type NginxSpec struct {
 	// replicas value.
 	// +optional
 	Replicas *int32 `json:"replicas,omitempty"`
+	// WorkloadKind 工作负载类型, 可选值 "Deployment", "DaemonSet" 或 "StatefulSet".
+	// 默认为 "Deployment".
+	// +kubebuilder:validation:Enum=Deployment;DaemonSet;StatefulSet
+	// +optional
+	WorkloadKind WorkloadKind `json:"workloadKind,omitempty"`
 	// Image是容器镜像名称。默认值为 "nginx:latest".
 	// +optional
 	Image string `json:"image,omitempty"`
 	// Config是对NGINX配置对象的引用，该对象存储NGINX配置文件。如果提供该文件，则将其装载在上的NGINX容器中
 	// "/etc/nginx/nginx.conf".
+	//
+	// operator 生成的配置片段(例如监控使用的 stub_status)会自动 include 到 Inline 配置的
+	// http 块中; 使用 ConfigMap 时需要在 http 块中手动添加 "include /etc/nginx/operator/http.conf;".
 	// +optional
 	Config *ConfigRef `json:"config,omitempty"`
 	// TLS configuration.
@@ -209,9 +879,15 @@ type NginxSpec struct {
 	// Template used to configure the nginx pod.
 	// +optional
 	PodTemplate PodTemplateSpec `json:"podTemplate,omitempty"`
-	// Service 服务配置
+	// Service 服务配置, 与 Services 互斥, 等价于只包含后缀 "service" 的 Services.
 	// +optional
 	Service *NginxService `json:"service,omitempty"`
+	// Services 多个 Service 配置, 例如网格内部使用的 ClusterIP 和公网使用的 LoadBalancer,
+	// 从列表中移除的 Service 会被删除.
+	// +optional
+	// +listType=map
+	// +listMapKey=nameSuffix
+	Services []NginxNamedService `json:"services,omitempty"`
 	// Ingress 配置
 	// +optional
 	Ingress *NginxIngress `json:"ingress,omitempty"`
@@ -219,17 +895,98 @@ type NginxSpec struct {
 	// working or not.
 	// +optional
 	HealthcheckPath string `json:"healthcheckPath,omitempty"`
+	// Content 静态文件来源.
+	// +optional
+	Content *NginxContent `json:"content,omitempty"`
+	// Auth 访问认证配置.
+	// +optional
+	Auth *NginxAuth `json:"auth,omitempty"`
+	// RateLimits 请求限流配置.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	RateLimits []NginxRateLimit `json:"rateLimits,omitempty"`
+	// ConnectionLimits 并发连接数限制.
+	// +optional
+	ConnectionLimits *NginxConnectionLimits `json:"connectionLimits,omitempty"`
+	// WAF ModSecurity Web 应用防火墙配置.
+	// +optional
+	WAF *NginxWAF `json:"waf,omitempty"`
+	// ErrorPages 自定义错误页面.
+	// +optional
+	// +listType=map
+	// +listMapKey=code
+	ErrorPages []NginxErrorPage `json:"errorPages,omitempty"`
+	// Maintenance 维护模式配置.
+	// +optional
+	Maintenance *NginxMaintenance `json:"maintenance,omitempty"`
+	// Probes 健康检查配置
+	// +optional
+	Probes *NginxProbes `json:"probes,omitempty"`
 	// Resources 资源限制
 	// +optional
 	Resources coreV1.ResourceRequirements `json:"resources,omitempty"`
+	// Cache 缓存卷配置, StatefulSet 模式下为每个 Pod 创建持久化缓存卷.
+	// +optional
+	Cache *NginxCache `json:"cache,omitempty"`
+	// Monitoring 监控配置.
+	// +optional
+	Monitoring *NginxMonitoring `json:"monitoring,omitempty"`
+	// Autoscaling 自动扩缩容配置, 配置后由 HorizontalPodAutoscaler 管理副本数,
+	// 此时忽略 Replicas 字段. DaemonSet 模式下每个节点一个 Pod, 不能配置.
+	// +optional
+	Autoscaling *NginxAutoscaling `json:"autoscaling,omitempty"`
+	// NetworkPolicy 网络策略配置.
+	// +optional
+	NetworkPolicy *NginxNetworkPolicy `json:"networkPolicy,omitempty"`
 }
 
 type DeploymentStatus struct {
 	Name string `json:"name"`
 }
 
+type DaemonSetStatus struct {
+	Name string `json:"name"`
+}
+
+type StatefulSetStatus struct {
+	Name string `json:"name"`
+}
+
 type ServiceStatus struct {
 	Name string `json:"name"`
+	// Type Service 类型
+	Type coreV1.ServiceType `json:"type,omitempty"`
+	// Address Service 的访问地址, LoadBalancer 类型为负载均衡的 IP 或域名, 其他类型为 ClusterIP
+	Address string `json:"address,omitempty"`
+}
+
+// ContentStatus 各 Pod 启动时同步到的内容版本. 启动后 git-sync sidecar 按 pollInterval 继续拉取新的 commit,
+// Pod 当前提供的版本可能比这里记录的更新, operator 不跟踪 sidecar 的同步进度.
+type ContentStatus struct {
+	// Revisions 按 Pod 数量从多到少排列, 滚动更新期间可能同时存在多个版本.
+	// +optional
+	Revisions []ContentRevisionStatus `json:"revisions,omitempty"`
+}
+
+type ContentRevisionStatus struct {
+	// InitialRevision Pod 启动时 git-sync init 容器同步到的 Git commit, 不是 Pod 当前提供的版本.
+	InitialRevision string `json:"initialRevision"`
+	// Pods 以该版本启动的 Pod 数量.
+	Pods int32 `json:"pods"`
+}
+
+// WAFStatus 当前 WAF 配置在 Pod 中的生效情况. 只反映配置, 不包含请求: operator 不读取审计日志,
+// 命中规则和被拦截的请求不会出现在 status, 事件或 operator 指标中, 只记录在 nginx 容器标准输出的 JSON 审计日志中,
+// 需要由日志系统采集和告警
+type WAFStatus struct {
+	// Mode 期望的运行模式.
+	Mode WAFMode `json:"mode"`
+	// ParanoiaLevel 期望的 CRS paranoia level.
+	// +optional
+	ParanoiaLevel int32 `json:"paranoiaLevel,omitempty"`
+	// Pods 已经以期望模式运行的 Pod 数量.
+	Pods int32 `json:"pods"`
 }
 
 type IngressStatus struct {
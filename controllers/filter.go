@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"hash/fnv"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// shouldManageNginx 判断 Nginx 实例是否由当前 operator 处理, 同时作为 watch 的过滤条件,
+// 不匹配的实例不会进入调谐队列
+func (r *NginxReconciler) shouldManageNginx(obj client.Object) bool {
+	if !r.inWatchNamespaces(obj.GetNamespace()) {
+		return false
+	}
+	// 空的过滤条件匹配所有实例
+	if r.AnnotationFilter != nil && !r.AnnotationFilter.Empty() &&
+		!r.AnnotationFilter.Matches(labels.Set(obj.GetAnnotations())) {
+		return false
+	}
+	if r.LabelSelector != nil && !r.LabelSelector.Empty() &&
+		!r.LabelSelector.Matches(labels.Set(obj.GetLabels())) {
+		return false
+	}
+	return r.inShard(obj)
+}
+
+// inWatchNamespaces manager 的缓存已经只包含监听的命名空间, 这里避免使用非缓存的 client 时处理其他命名空间的实例
+func (r *NginxReconciler) inWatchNamespaces(namespace string) bool {
+	if len(r.WatchNamespaces) == 0 {
+		return true
+	}
+	for _, ns := range r.WatchNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// inShard 根据 namespace/name 的哈希值将实例分配到各个分片, 多个 operator 副本分别处理一部分实例
+func (r *NginxReconciler) inShard(obj client.Object) bool {
+	if r.ShardCount <= 1 {
+		return true
+	}
+	return ShardFor(obj.GetNamespace(), obj.GetName(), r.ShardCount) == r.ShardID
+}
+
+// ShardFor 返回 namespace/name 所属的分片编号
+func ShardFor(namespace, name string, shardCount int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(namespace + "/" + name))
+	return int(hash.Sum32() % uint32(shardCount))
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// 除 controller-runtime 默认指标之外, operator 自定义的指标, 注册到 metrics.Registry 后通过 manager 的 /metrics 暴露
+
+const metricsNamespace = "nginx_operator"
+
+// 调谐阶段, 作为 reconcile_phase_duration_seconds 的 phase 标签
+const (
+	phaseConfig         = "config"
+	phasePodSecurity    = "podsecurity"
+	phaseWorkload       = "workload"
+	phaseAutoscaling    = "autoscaling"
+	phaseService        = "service"
+	phaseNetworkPolicy  = "networkpolicy"
+	phaseIngress        = "ingress"
+	phaseServiceMonitor = "servicemonitor"
+	phasePrune          = "prune"
+	phaseStatus         = "status"
+)
+
+var (
+	reconcilePhaseDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "reconcile_phase_duration_seconds",
+			Help:      "Duration of each reconcile phase of an Nginx instance.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"phase"},
+	)
+
+	childOperations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "child_operations_total",
+			Help:      "Number of create/update/delete calls made on child resources, by kind and result.",
+		},
+		[]string{"kind", "operation", "result"},
+	)
+
+	configValidationFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "config_validation_failures_total",
+			Help:      "Number of times an Nginx instance failed config validation.",
+		},
+		[]string{"namespace", "nginx"},
+	)
+
+	instancesByCondition = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "instances",
+			Help:      "Number of managed Nginx instances by the status of their Ready condition.",
+		},
+		[]string{"condition", "status"},
+	)
+
+	desiredReplicas = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "desired_replicas",
+			Help:      "Desired number of nginx pods per Nginx instance.",
+		},
+		[]string{"namespace", "nginx"},
+	)
+
+	currentReplicas = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "current_replicas",
+			Help:      "Current number of nginx pods per Nginx instance.",
+		},
+		[]string{"namespace", "nginx"},
+	)
+
+	wafMode = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "waf_mode",
+			Help:      "Desired WAF mode per Nginx instance, 1 for the current mode.",
+		},
+		[]string{"namespace", "nginx", "mode"},
+	)
+
+	wafPods = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "waf_pods",
+			Help:      "Number of running nginx pods with the desired WAF mode per Nginx instance.",
+		},
+		[]string{"namespace", "nginx"},
+	)
+
+	// readyConditions 记录每个实例 Ready 条件的状态, 用于计算 instances 指标
+	readyConditions = &instanceConditions{statuses: map[types.NamespacedName]metaV1.ConditionStatus{}}
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		reconcilePhaseDuration,
+		childOperations,
+		configValidationFailures,
+		instancesByCondition,
+		desiredReplicas,
+		currentReplicas,
+		wafMode,
+		wafPods,
+	)
+}
+
+// observeReconcilePhase 执行调谐阶段并记录耗时
+func observeReconcilePhase(phase string, f func() error) error {
+	start := time.Now()
+	defer func() {
+		reconcilePhaseDuration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+	}()
+	return f()
+}
+
+func recordChildOperation(kind, operation string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	childOperations.WithLabelValues(kind, operation, result).Inc()
+}
+
+func recordReplicas(key types.NamespacedName, desired, current int32) {
+	desiredReplicas.WithLabelValues(key.Namespace, key.Name).Set(float64(desired))
+	currentReplicas.WithLabelValues(key.Namespace, key.Name).Set(float64(current))
+}
+
+// recordWAF 未配置 WAF 时清理相关指标
+func recordWAF(key types.NamespacedName, status *devopsV1.WAFStatus) {
+	wafMode.DeletePartialMatch(prometheus.Labels{"namespace": key.Namespace, "nginx": key.Name})
+	if status == nil {
+		wafPods.DeleteLabelValues(key.Namespace, key.Name)
+		return
+	}
+	wafMode.WithLabelValues(key.Namespace, key.Name, string(status.Mode)).Set(1)
+	wafPods.WithLabelValues(key.Namespace, key.Name).Set(float64(status.Pods))
+}
+
+// forgetInstanceMetrics 实例删除后清理与之相关的指标
+func forgetInstanceMetrics(key types.NamespacedName) {
+	desiredReplicas.DeleteLabelValues(key.Namespace, key.Name)
+	currentReplicas.DeleteLabelValues(key.Namespace, key.Name)
+	configValidationFailures.DeleteLabelValues(key.Namespace, key.Name)
+	recordWAF(key, nil)
+	readyConditions.forget(key)
+}
+
+type instanceConditions struct {
+	sync.Mutex
+	statuses map[types.NamespacedName]metaV1.ConditionStatus
+}
+
+func (c *instanceConditions) set(key types.NamespacedName, status metaV1.ConditionStatus) {
+	c.Lock()
+	defer c.Unlock()
+	c.statuses[key] = status
+	c.refresh()
+}
+
+func (c *instanceConditions) forget(key types.NamespacedName) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.statuses, key)
+	c.refresh()
+}
+
+func (c *instanceConditions) refresh() {
+	counts := map[metaV1.ConditionStatus]int{
+		metaV1.ConditionTrue:    0,
+		metaV1.ConditionFalse:   0,
+		metaV1.ConditionUnknown: 0,
+	}
+	for _, status := range c.statuses {
+		counts[status]++
+	}
+	for status, count := range counts {
+		instancesByCondition.WithLabelValues("Ready", string(status)).Set(float64(count))
+	}
+}
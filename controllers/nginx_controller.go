@@ -22,34 +22,39 @@ import (
 	"github.com/go-logr/logr"
 	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
 	"github.com/tomoncle/k8s-operator-nginx/pkg/k8s"
+	"github.com/tomoncle/k8s-operator-nginx/pkg/k8s/ingressprofile"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	appsV1 "k8s.io/api/apps/v1"
+	autoscalingV2 "k8s.io/api/autoscaling/v2"
 	coreV1 "k8s.io/api/core/v1"
 	networkingV1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/client-go/tools/record"
 	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	"sort"
 	"strings"
-	"time"
 )
 
-const KubeBuilder = `
-##    ## ##     ## ########  ######## ########  ##     ## #### ##       ########  ######## ########  
-##   ##  ##     ## ##     ## ##       ##     ## ##     ##  ##  ##       ##     ## ##       ##     ## 
-##  ##   ##     ## ##     ## ##       ##     ## ##     ##  ##  ##       ##     ## ##       ##     ## 
-#####    ##     ## ########  ######   ########  ##     ##  ##  ##       ##     ## ######   ########  
-##  ##   ##     ## ##     ## ##       ##     ## ##     ##  ##  ##       ##     ## ##       ##   ##   
-##   ##  ##     ## ##     ## ##       ##     ## ##     ##  ##  ##       ##     ## ##       ##    ##  
-##    ##  #######  ########  ######## ########   #######  #### ######## ########  ######## ##     ##
-`
-
 // 控制器最终会在群集上运行，因此 需要 RBAC 权限，使用控制器工具 RBAC 标记指定这些权限。
 // 这些是运行所需的最低权限。有需要自己再添加。
 // https://book.kubebuilder.io/reference/markers/rbac.html
@@ -57,10 +62,20 @@ const KubeBuilder = `
 // +kubebuilder:rbac:groups=devops.github.com,resources=nginxes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=devops.github.com,resources=nginxes/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=devops.github.com,resources=nginxes/finalizers,verbs=update
-// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;delete
-// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;delete
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;update;patch
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;create;update;delete
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=traefik.io,resources=middlewares,verbs=get;list;watch;create;update;delete
 
 // NginxReconciler reconciles a Nginx object
 type NginxReconciler struct {
@@ -69,11 +84,74 @@ type NginxReconciler struct {
 	Log              logr.Logger
 	Scheme           *runtime.Scheme
 	AnnotationFilter labels.Selector
+	// LabelSelector 只处理 labels 匹配的 Nginx 实例, 为空时处理所有实例
+	LabelSelector labels.Selector
+	// ShardCount 大于 1 时, 只处理 namespace/name 哈希后属于 ShardID 分片的实例
+	ShardID    int
+	ShardCount int
+	// WatchNamespaces 只处理这些命名空间中的实例, 为空时处理所有命名空间
+	WatchNamespaces []string
+	// Tracer 用于创建调谐过程的 span, 为空时使用全局 TracerProvider
+	Tracer trace.Tracer
+	// APIReader 直接读取 API Server, 用于不需要缓存的资源
+	APIReader client.Reader
+}
+
+// loggerFrom 返回 Reconcile 放入 ctx 的 logger(带有 nginx/namespace/reconcileID), 不存在时使用 r.Log
+func (r *NginxReconciler) loggerFrom(ctx context.Context, name string) logr.Logger {
+	logger, err := logr.FromContext(ctx)
+	if err != nil {
+		logger = r.Log
+	}
+	return logger.WithName(name)
+}
+
+// childKind 返回子资源的类型, 用于指标标签
+func (r *NginxReconciler) childKind(obj client.Object) string {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return "Unknown"
+	}
+	return gvk.Kind
+}
+
+// observeChildOperation 记录子资源操作的指标和日志
+func (r *NginxReconciler) observeChildOperation(ctx context.Context, obj client.Object, operation string, err error) {
+	kind := r.childKind(obj)
+	recordChildOperation(kind, operation, err)
+	if err == nil {
+		r.loggerFrom(ctx, "child").V(1).Info("子资源操作: 成功",
+			"operation", operation, "kind", kind, "child", obj.GetName(), "revision", obj.GetResourceVersion())
+	}
+}
+
+func (r *NginxReconciler) createChild(ctx context.Context, obj client.Object) error {
+	err := r.Client.Create(ctx, obj)
+	r.observeChildOperation(ctx, obj, "create", err)
+	return err
+}
+
+func (r *NginxReconciler) updateChild(ctx context.Context, obj client.Object) error {
+	err := r.Client.Update(ctx, obj)
+	r.observeChildOperation(ctx, obj, "update", err)
+	return err
+}
+
+func (r *NginxReconciler) patchChild(ctx context.Context, obj client.Object, patch client.Patch) error {
+	err := r.Client.Patch(ctx, obj, patch)
+	r.observeChildOperation(ctx, obj, "update", err)
+	return err
+}
+
+func (r *NginxReconciler) deleteChild(ctx context.Context, obj client.Object) error {
+	err := r.Client.Delete(ctx, obj)
+	r.observeChildOperation(ctx, obj, "delete", err)
+	return err
 }
 
 func (r *NginxReconciler) listDeployments(ctx context.Context, obj *devopsV1.Nginx) ([]appsV1.Deployment, error) {
-	logger := r.Log.WithName("listDeployments").WithValues("命名空间", obj.Namespace)
-	logger.Info("查询 Nginx Deployments 列表(根据label筛选)")
+	logger := r.loggerFrom(ctx, "listDeployments")
+	logger.V(1).Info("查询 Nginx Deployments 列表(根据label筛选)")
 
 	var deployList appsV1.DeploymentList
 	err := r.Client.List(ctx, &deployList, &client.ListOptions{
@@ -85,43 +163,74 @@ func (r *NginxReconciler) listDeployments(ctx context.Context, obj *devopsV1.Ngi
 		return nil, err
 	}
 
-	deploys := deployList.Items
-	for _, i := range deploys {
-		logger.Info("查询 Nginx Deployment", "详情", i.Name, "状态", i.Status)
-	}
-	// 如果根据标签查询不到，就不根据标签查了
-	if len(deploys) == 0 {
-		err = r.Client.List(ctx, &deployList, &client.ListOptions{
-			Namespace: obj.Namespace,
-		})
-		if err != nil {
-			return nil, err
-		}
-
-		cr := *metaV1.NewControllerRef(obj, schema.GroupVersionKind{
-			Group:   devopsV1.GroupVersion.Group,
-			Version: devopsV1.GroupVersion.Version,
-			Kind:    devopsV1.Kind,
-		})
-
-		for _, deploy := range deployList.Items {
-			for _, owner := range deploy.OwnerReferences {
-				if reflect.DeepEqual(owner, cr) {
-					deploys = append(deploys, deploy)
-				}
-			}
+	var deploys []appsV1.Deployment
+	for _, i := range deployList.Items {
+		// 只统计由当前 CRD 实例管理的 Deployment
+		if !metaV1.IsControlledBy(&i, obj) {
+			continue
 		}
+		logger.V(2).Info("查询 Nginx Deployment", "child", i.Name, "replicas", i.Status.Replicas, "readyReplicas", i.Status.ReadyReplicas)
+		deploys = append(deploys, i)
 	}
-
 	sort.Slice(deploys, func(i, j int) bool {
 		return deploys[i].Name < deploys[j].Name
 	})
 	return deploys, nil
 }
 
+func (r *NginxReconciler) listDaemonSets(ctx context.Context, obj *devopsV1.Nginx) ([]appsV1.DaemonSet, error) {
+	logger := r.loggerFrom(ctx, "listDaemonSets")
+	logger.V(1).Info("查询 Nginx DaemonSets 列表(根据label筛选)")
+
+	var daemonSetList appsV1.DaemonSetList
+	err := r.Client.List(ctx, &daemonSetList, &client.ListOptions{
+		Namespace:     obj.Namespace,
+		LabelSelector: labels.SelectorFromSet(k8s.LabelsForNginx(obj.Name)),
+	})
+	if err != nil {
+		logger.Error(err, "查询 Nginx DaemonSets 列表：失败")
+		return nil, err
+	}
+
+	daemonSets := daemonSetList.Items
+	for _, i := range daemonSets {
+		logger.V(2).Info("查询 Nginx DaemonSet", "child", i.Name, "scheduled", i.Status.CurrentNumberScheduled, "ready", i.Status.NumberReady)
+	}
+
+	sort.Slice(daemonSets, func(i, j int) bool {
+		return daemonSets[i].Name < daemonSets[j].Name
+	})
+	return daemonSets, nil
+}
+
+func (r *NginxReconciler) listStatefulSets(ctx context.Context, obj *devopsV1.Nginx) ([]appsV1.StatefulSet, error) {
+	logger := r.loggerFrom(ctx, "listStatefulSets")
+	logger.V(1).Info("查询 Nginx StatefulSets 列表(根据label筛选)")
+
+	var statefulSetList appsV1.StatefulSetList
+	err := r.Client.List(ctx, &statefulSetList, &client.ListOptions{
+		Namespace:     obj.Namespace,
+		LabelSelector: labels.SelectorFromSet(k8s.LabelsForNginx(obj.Name)),
+	})
+	if err != nil {
+		logger.Error(err, "查询 Nginx StatefulSets 列表：失败")
+		return nil, err
+	}
+
+	statefulSets := statefulSetList.Items
+	for _, i := range statefulSets {
+		logger.V(2).Info("查询 Nginx StatefulSet", "child", i.Name, "replicas", i.Status.Replicas, "readyReplicas", i.Status.ReadyReplicas)
+	}
+
+	sort.Slice(statefulSets, func(i, j int) bool {
+		return statefulSets[i].Name < statefulSets[j].Name
+	})
+	return statefulSets, nil
+}
+
 // listServices return all the services for the given nginx sorted by name
 func (r *NginxReconciler) listServices(ctx context.Context, obj *devopsV1.Nginx) ([]devopsV1.ServiceStatus, error) {
-	logger := r.Log.WithName("listServices").WithValues("命名空间", obj.Namespace)
+	logger := r.loggerFrom(ctx, "listServices")
 	serviceList := &coreV1.ServiceList{}
 	labelSelector := labels.SelectorFromSet(k8s.LabelsForNginx(obj.Name))
 	listOps := &client.ListOptions{Namespace: obj.Namespace, LabelSelector: labelSelector}
@@ -133,9 +242,11 @@ func (r *NginxReconciler) listServices(ctx context.Context, obj *devopsV1.Nginx)
 
 	var services []devopsV1.ServiceStatus
 	for _, s := range serviceList.Items {
-		logger.Info("查询 Nginx Service", "详情", s.Name, "状态", s.Status)
+		logger.V(2).Info("查询 Nginx Service", "child", s.Name, "type", s.Spec.Type)
 		services = append(services, devopsV1.ServiceStatus{
-			Name: s.Name,
+			Name:    s.Name,
+			Type:    s.Spec.Type,
+			Address: getServiceAddress(&s),
 		})
 	}
 
@@ -146,8 +257,26 @@ func (r *NginxReconciler) listServices(ctx context.Context, obj *devopsV1.Nginx)
 	return services, nil
 }
 
+// getServiceAddress 返回 Service 的访问地址, LoadBalancer 分配地址前返回 ClusterIP
+func getServiceAddress(s *coreV1.Service) string {
+	if s.Spec.Type == coreV1.ServiceTypeLoadBalancer {
+		for _, ingress := range s.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				return ingress.IP
+			}
+			if ingress.Hostname != "" {
+				return ingress.Hostname
+			}
+		}
+	}
+	if s.Spec.ClusterIP == coreV1.ClusterIPNone {
+		return ""
+	}
+	return s.Spec.ClusterIP
+}
+
 func (r *NginxReconciler) listIngresses(ctx context.Context, obj *devopsV1.Nginx) ([]devopsV1.IngressStatus, error) {
-	logger := r.Log.WithName("listIngresses").WithValues("命名空间", obj.Namespace)
+	logger := r.loggerFrom(ctx, "listIngresses")
 	var ingressList networkingV1.IngressList
 
 	options := &client.ListOptions{
@@ -161,7 +290,7 @@ func (r *NginxReconciler) listIngresses(ctx context.Context, obj *devopsV1.Nginx
 
 	var ingresses []devopsV1.IngressStatus
 	for _, i := range ingressList.Items {
-		logger.Info("查询 Nginx Ingress", "详情", i.Name, "状态", i.Status)
+		logger.V(2).Info("查询 Nginx Ingress", "child", i.Name)
 		ingresses = append(ingresses, devopsV1.IngressStatus{Name: i.Name})
 	}
 
@@ -172,67 +301,149 @@ func (r *NginxReconciler) listIngresses(ctx context.Context, obj *devopsV1.Nginx
 	return ingresses, nil
 }
 
-func (r *NginxReconciler) listPods(ctx context.Context, obj *devopsV1.Nginx) error {
-	logger := r.Log.WithName("listPods").WithValues("命名空间", obj.Namespace)
+func (r *NginxReconciler) listPods(ctx context.Context, obj *devopsV1.Nginx) ([]coreV1.Pod, error) {
+	logger := r.loggerFrom(ctx, "listPods")
 	var podList coreV1.PodList
 	err := r.Client.List(ctx, &podList, &client.ListOptions{
 		Namespace:     obj.Namespace,
 		LabelSelector: labels.SelectorFromSet(k8s.LabelsForNginx(obj.Name)),
 	})
 	if err != nil {
-		logger.Error(err, "查询失败.")
-		return err
-	} else {
-		logger.Info("查询 Nginx POD 列表：成功", "数量", len(podList.Items))
-		for _, pod := range podList.Items {
-			logger.Info("查询 Nginx POD 列表：成功", "详情", pod.ObjectMeta.Name, "状态", pod.Status.Phase)
+		logger.Error(err, "查询 Nginx POD 列表：失败")
+		return nil, err
+	}
+	logger.V(1).Info("查询 Nginx POD 列表：成功", "count", len(podList.Items))
+	for _, pod := range podList.Items {
+		logger.V(2).Info("查询 Nginx POD", "child", pod.Name, "phase", pod.Status.Phase)
+	}
+	return podList.Items, nil
+}
+
+// getContentStatus 汇总各 Pod 的 git-sync init 容器写入 termination message 的 commit, 即 Pod 启动时的版本
+func getContentStatus(obj *devopsV1.Nginx, pods []coreV1.Pod) *devopsV1.ContentStatus {
+	if !k8s.IsGitContentEnabled(obj) {
+		return nil
+	}
+
+	counts := map[string]int32{}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, s := range pod.Status.InitContainerStatuses {
+			if s.Name != k8s.GitSyncInitContainerName || s.State.Terminated == nil || s.State.Terminated.ExitCode != 0 {
+				continue
+			}
+			if revision := strings.TrimSpace(s.State.Terminated.Message); revision != "" {
+				counts[revision]++
+			}
 		}
 	}
-	return nil
+
+	status := &devopsV1.ContentStatus{}
+	for revision, pods := range counts {
+		status.Revisions = append(status.Revisions, devopsV1.ContentRevisionStatus{InitialRevision: revision, Pods: pods})
+	}
+	sort.Slice(status.Revisions, func(i, j int) bool {
+		if status.Revisions[i].Pods != status.Revisions[j].Pods {
+			return status.Revisions[i].Pods > status.Revisions[j].Pods
+		}
+		return status.Revisions[i].InitialRevision < status.Revisions[j].InitialRevision
+	})
+	return status
 }
 
-func (r *NginxReconciler) listNginx(ctx context.Context) {
-	logger := r.Log.WithName("listNginx")
-	var nginxList devopsV1.NginxList
-	err := r.Client.List(ctx, &nginxList, &client.ListOptions{})
-	if err != nil {
-		logger.Error(err, "查询失败.")
-	} else {
-		logger.Info("查询 Nginx 列表：成功", "count", len(nginxList.Items))
-		for _, nginx := range nginxList.Items {
-			logger.Info("查询 Nginx 列表：成功", "nginx", nginx.Name)
+// getWAFStatus 统计 Pod 模板上 WAF 运行模式与期望一致的 Pod, 滚动更新完成前新旧模式的 Pod 同时存在
+func getWAFStatus(obj *devopsV1.Nginx, pods []coreV1.Pod) *devopsV1.WAFStatus {
+	if obj.Spec.WAF == nil {
+		return nil
+	}
+	status := &devopsV1.WAFStatus{Mode: k8s.GetWAFMode(obj), ParanoiaLevel: k8s.GetWAFParanoiaLevel(obj)}
+	if !k8s.IsWAFEnabled(obj) {
+		return status
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil && pod.Status.Phase == coreV1.PodRunning &&
+			pod.Annotations[k8s.WAFModeAnnotation] == string(status.Mode) {
+			status.Pods++
 		}
 	}
+	return status
 }
 
-func (r *NginxReconciler) refreshStatus(ctx context.Context, obj *devopsV1.Nginx) error {
-	logger := r.Log.WithName("refreshStatus").WithValues("命名空间", obj.Namespace)
+// refreshStatus 汇总子资源状态, observed 是调谐前从集群中读取的状态, 调谐步骤中设置的 condition 保存在 obj.Status 中
+func (r *NginxReconciler) refreshStatus(ctx context.Context, obj *devopsV1.Nginx, observed devopsV1.NginxStatus) (err error) {
+	ctx, span := r.startSpan(ctx, "refreshStatus", obj)
+	defer func() { endSpan(span, err) }()
 
-	logger.Info("查询 Deployment 列表")
+	logger := r.loggerFrom(ctx, "refreshStatus")
+
+	logger.V(1).Info("查询 Deployment 列表")
 	deploys, err := r.listDeployments(ctx, obj)
 	if err != nil {
 		return err
 	}
 
 	var deployStatuses []devopsV1.DeploymentStatus
-	var replicas int32
+	var replicas, desired, ready int32
 	for _, d := range deploys {
 		replicas += d.Status.Replicas
+		ready += d.Status.ReadyReplicas
+		desired += replicasOrDefault(d.Spec.Replicas)
 		deployStatuses = append(deployStatuses, devopsV1.DeploymentStatus{Name: d.Name})
 	}
 
-	logger.Info("查询 Service 列表")
+	logger.V(1).Info("查询 DaemonSet 列表")
+	daemonSets, err := r.listDaemonSets(ctx, obj)
+	if err != nil {
+		return fmt.Errorf("failed to list daemonsets for nginx: %w", err)
+	}
+
+	var daemonSetStatuses []devopsV1.DaemonSetStatus
+	for _, ds := range daemonSets {
+		replicas += ds.Status.CurrentNumberScheduled
+		ready += ds.Status.NumberReady
+		desired += ds.Status.DesiredNumberScheduled
+		daemonSetStatuses = append(daemonSetStatuses, devopsV1.DaemonSetStatus{Name: ds.Name})
+	}
+
+	logger.V(1).Info("查询 StatefulSet 列表")
+	statefulSets, err := r.listStatefulSets(ctx, obj)
+	if err != nil {
+		return fmt.Errorf("failed to list statefulsets for nginx: %w", err)
+	}
+
+	var statefulSetStatuses []devopsV1.StatefulSetStatus
+	for _, sts := range statefulSets {
+		replicas += sts.Status.Replicas
+		ready += sts.Status.ReadyReplicas
+		desired += replicasOrDefault(sts.Spec.Replicas)
+		statefulSetStatuses = append(statefulSetStatuses, devopsV1.StatefulSetStatus{Name: sts.Name})
+	}
+
+	logger.V(1).Info("查询 Service 列表")
 	services, err := r.listServices(ctx, obj)
 	if err != nil {
 		return fmt.Errorf("failed to list services for nginx: %v", err)
 	}
 
-	logger.Info("查询 Ingress 列表")
+	logger.V(1).Info("查询 Ingress 列表")
 	ingresses, err := r.listIngresses(ctx, obj)
 	if err != nil {
 		return fmt.Errorf("failed to list ingresses for nginx: %w", err)
 	}
 
+	// 静态内容版本和 WAF 生效状态都从 Pod 汇总, 只查询一次
+	var pods []coreV1.Pod
+	if k8s.IsGitContentEnabled(obj) || k8s.IsWAFEnabled(obj) {
+		logger.V(1).Info("查询 Pod 列表")
+		if pods, err = r.listPods(ctx, obj); err != nil {
+			return fmt.Errorf("failed to list pods for nginx: %w", err)
+		}
+	}
+	content := getContentStatus(obj, pods)
+	waf := getWAFStatus(obj, pods)
+
 	sort.Slice(obj.Status.Services, func(i, j int) bool {
 		return obj.Status.Services[i].Name < obj.Status.Services[j].Name
 	})
@@ -245,16 +456,30 @@ func (r *NginxReconciler) refreshStatus(ctx context.Context, obj *devopsV1.Nginx
 		CurrentReplicas: replicas,
 		PodSelector:     labels.FormatLabels(k8s.LabelsForNginx(obj.Name)),
 		Deployments:     deployStatuses,
+		DaemonSets:      daemonSetStatuses,
+		StatefulSets:    statefulSetStatuses,
 		Services:        services,
 		Ingresses:       ingresses,
+		Content:         content,
+		WAF:             waf,
+		Conditions:      append([]metaV1.Condition(nil), obj.Status.Conditions...),
+	}
+	meta.SetStatusCondition(&status.Conditions, getReadyCondition(obj, desired, ready))
+
+	key := client.ObjectKeyFromObject(obj)
+	recordReplicas(key, desired, replicas)
+	recordWAF(key, waf)
+	if waf != nil && (observed.WAF == nil || observed.WAF.Mode != waf.Mode) {
+		r.EventRecorder.Eventf(obj, coreV1.EventTypeNormal, "WAFModeChanged", "WAF 运行模式切换为 %s", waf.Mode)
 	}
+	readyConditions.set(key, meta.FindStatusCondition(status.Conditions, devopsV1.ConditionTypeReady).Status)
 
-	if reflect.DeepEqual(obj.Status, status) {
-		logger.Info("未检测到资源变化")
+	if reflect.DeepEqual(observed, status) {
+		logger.V(1).Info("未检测到资源变化")
 		return nil
 	}
 
-	logger.Info("更新资源状态")
+	logger.Info("更新资源状态", "replicas", status.CurrentReplicas)
 	obj.Status = status
 	err = r.Client.Status().Update(ctx, obj)
 	if err != nil {
@@ -264,50 +489,411 @@ func (r *NginxReconciler) refreshStatus(ctx context.Context, obj *devopsV1.Nginx
 	return nil
 }
 
-func (r *NginxReconciler) shouldManageNginx(obj *devopsV1.Nginx) bool {
-	logger := r.Log.WithName("shouldManageNginx").WithValues("命名空间", obj.Namespace)
-	logger.Info("判断CRD实例是否匹配AnnotationFilter: 执行")
-	// empty filter matches all resources
-	if r.AnnotationFilter == nil || r.AnnotationFilter.Empty() {
-		return true
+func replicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
 	}
-	return r.AnnotationFilter.Matches(labels.Set(obj.Annotations))
+	return *replicas
+}
+
+// getReadyCondition 根据工作负载的就绪副本数生成 Ready 条件
+func getReadyCondition(obj *devopsV1.Nginx, desired, ready int32) metaV1.Condition {
+	condition := metaV1.Condition{
+		Type:               devopsV1.ConditionTypeReady,
+		Status:             metaV1.ConditionTrue,
+		ObservedGeneration: obj.Generation,
+		Reason:             "PodsReady",
+		Message:            fmt.Sprintf("%d/%d pods ready", ready, desired),
+	}
+	if ready < desired {
+		condition.Status = metaV1.ConditionFalse
+		condition.Reason = "PodsNotReady"
+	}
+	return condition
 }
 
 func (r *NginxReconciler) reconcileNginx(ctx context.Context, obj *devopsV1.Nginx) error {
-	logger := r.Log.WithName("reconcileNginx").WithValues("命名空间", obj.Namespace)
-	logger.Info("处理CRD实例: 执行 -> step1. 处理 Deployment")
-	if err := r.reconcileDeployment(ctx, obj); err != nil {
+	logger := r.loggerFrom(ctx, "reconcileNginx")
+
+	logger.V(1).Info("处理CRD实例: 执行 -> 校验配置")
+	if err := k8s.Validate(obj); err != nil {
+		logger.Error(err, "校验配置: 失败")
+		configValidationFailures.WithLabelValues(obj.Namespace, obj.Name).Inc()
+		r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "InvalidConfig", "配置校验失败: %s", err)
 		return err
 	}
-	logger.Info("处理CRD实例: 执行 -> step2. 处理 Service")
-	if err := r.reconcileService(ctx, obj); err != nil {
+
+	steps := []struct {
+		phase     string
+		desc      string
+		reconcile func(context.Context, *devopsV1.Nginx) error
+	}{
+		{phaseConfig, "step1. 处理生成的配置", r.reconcileGeneratedConfig},
+		{phaseConfig, "step2. 检查 ConfigMap 配置是否引用生成的配置", r.reconcileConfigIncludes},
+		{phaseConfig, "step3. 处理维护模式 ConfigMap", r.reconcileMaintenanceConfig},
+		{phaseConfig, "step4. 处理 basic 认证 Secret", r.reconcileBasicAuthSecret},
+		{phasePodSecurity, "step5. 检查 Pod Security Standards", r.reconcilePodSecurity},
+		{phaseWorkload, "step6. 处理工作负载", r.reconcileWorkload},
+		{phaseAutoscaling, "step7. 处理 HorizontalPodAutoscaler", r.reconcileHorizontalPodAutoscaler},
+		{phaseService, "step8. 处理 Service", r.reconcileService},
+		{phaseNetworkPolicy, "step9. 处理 NetworkPolicy", r.reconcileNetworkPolicy},
+		{phaseIngress, "step10. 处理 Ingress", r.reconcileIngress},
+		{phaseIngress, "step11. 处理 oauth2-proxy Ingress", r.reconcileOAuth2ProxyIngress},
+		{phaseIngress, "step12. 处理 Ingress features 需要的资源", r.reconcileIngressFeatureObjects},
+		{phaseServiceMonitor, "step13. 处理 ServiceMonitor", r.reconcileServiceMonitor},
+		{phasePrune, "step14. 清理不再需要的子资源", r.pruneChildren},
+	}
+	for _, step := range steps {
+		logger.V(1).Info("处理CRD实例: 执行 -> "+step.desc, "phase", step.phase)
+		if err := observeReconcilePhase(step.phase, func() error { return step.reconcile(ctx, obj) }); err != nil {
+			return err
+		}
+	}
+	logger.V(1).Info("处理CRD实例: 结束")
+	return nil
+}
+
+// reconcileGeneratedConfig 维护保存 operator 生成配置片段的 ConfigMap
+func (r *NginxReconciler) reconcileGeneratedConfig(ctx context.Context, obj *devopsV1.Nginx) error {
+	logger := r.loggerFrom(ctx, "reconcileGeneratedConfig")
+
+	newConfigMap := k8s.NewGeneratedConfigMap(obj)
+	var currentConfigMap coreV1.ConfigMap
+	err := r.Client.Get(ctx, types.NamespacedName{Name: newConfigMap.Name, Namespace: newConfigMap.Namespace}, &currentConfigMap)
+	if errors.IsNotFound(err) {
+		if !k8s.HasGeneratedConfig(obj) {
+			return nil
+		}
+		logger.Info("新建 Nginx 生成配置 ConfigMap", "child", newConfigMap.Name)
+		return r.createChild(ctx, newConfigMap)
+	}
+
+	if err != nil {
+		logger.Error(err, "查询 Nginx 生成配置 ConfigMap: 失败")
 		return err
 	}
-	logger.Info("处理CRD实例: 执行 -> step3. 处理 Ingress")
-	if err := r.reconcileIngress(ctx, obj); err != nil {
+
+	// 没有需要生成的配置时, 多余的 ConfigMap 由 pruneChildren 删除
+	if !k8s.HasGeneratedConfig(obj) {
+		return nil
+	}
+
+	if reflect.DeepEqual(currentConfigMap.Data, newConfigMap.Data) &&
+		reflect.DeepEqual(currentConfigMap.Labels, newConfigMap.Labels) {
+		return nil
+	}
+
+	logger.Info("更新 Nginx 生成配置 ConfigMap", "child", newConfigMap.Name, "revision", currentConfigMap.ResourceVersion)
+	newConfigMap.ResourceVersion = currentConfigMap.ResourceVersion
+	return r.updateChild(ctx, newConfigMap)
+}
+
+// reconcileMaintenanceConfig 维护保存维护模式开关和默认维护页面的 ConfigMap, 该 ConfigMap 不参与生成配置的校验和,
+// 切换维护模式只更新 ConfigMap, 由 kubelet 同步到 Pod 中
+func (r *NginxReconciler) reconcileMaintenanceConfig(ctx context.Context, obj *devopsV1.Nginx) error {
+	logger := r.loggerFrom(ctx, "reconcileMaintenanceConfig")
+
+	// 未配置维护模式时, 多余的 ConfigMap 由 pruneChildren 删除
+	if !k8s.IsMaintenanceConfigured(obj) {
+		return nil
+	}
+
+	newConfigMap := k8s.NewMaintenanceConfigMap(obj)
+	var currentConfigMap coreV1.ConfigMap
+	err := r.Client.Get(ctx, types.NamespacedName{Name: newConfigMap.Name, Namespace: newConfigMap.Namespace}, &currentConfigMap)
+	if errors.IsNotFound(err) {
+		logger.Info("新建 Nginx 维护模式 ConfigMap", "child", newConfigMap.Name, "enabled", k8s.IsMaintenanceEnabled(obj))
+		return r.createChild(ctx, newConfigMap)
+	}
+
+	if err != nil {
+		logger.Error(err, "查询 Nginx 维护模式 ConfigMap: 失败")
 		return err
 	}
-	logger.Info("处理CRD实例: 结束")
+
+	if reflect.DeepEqual(currentConfigMap.Data, newConfigMap.Data) &&
+		reflect.DeepEqual(currentConfigMap.Labels, newConfigMap.Labels) {
+		return nil
+	}
+
+	_, wasEnabled := currentConfigMap.Data[k8s.MaintenanceFlagKey]
+	logger.Info("更新 Nginx 维护模式 ConfigMap", "child", newConfigMap.Name, "revision", currentConfigMap.ResourceVersion,
+		"enabled", k8s.IsMaintenanceEnabled(obj))
+	newConfigMap.ResourceVersion = currentConfigMap.ResourceVersion
+	if err := r.updateChild(ctx, newConfigMap); err != nil {
+		return err
+	}
+	if wasEnabled != k8s.IsMaintenanceEnabled(obj) {
+		r.EventRecorder.Eventf(obj, coreV1.EventTypeNormal, "MaintenanceModeChanged", "维护模式切换为 %t", k8s.IsMaintenanceEnabled(obj))
+	}
+	return nil
+}
+
+// reconcileBasicAuthSecret 读取用户 Secret, 维护保存 htpasswd 文件的 Secret.
+// 用户 Secret 不存在或格式错误时只产生事件, nginx Pod 因缺少 htpasswd Secret 无法启动, 不会在未认证的情况下对外服务
+func (r *NginxReconciler) reconcileBasicAuthSecret(ctx context.Context, obj *devopsV1.Nginx) error {
+	logger := r.loggerFrom(ctx, "reconcileBasicAuthSecret")
+
+	// 未开启认证时, 多余的 Secret 由 pruneChildren 删除
+	sourceName := k8s.GetBasicAuthSourceSecretName(obj)
+	if sourceName == "" {
+		return nil
+	}
+
+	// 用户 Secret 不在缓存中, 直接从 API server 读取
+	var source coreV1.Secret
+	err := r.apiReader().Get(ctx, types.NamespacedName{Name: sourceName, Namespace: obj.Namespace}, &source)
+	if errors.IsNotFound(err) {
+		logger.Info("basic 认证用户 Secret 不存在", "secret", sourceName)
+		r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "InvalidBasicAuth", "basic 认证用户 Secret %s 不存在", sourceName)
+		return nil
+	}
+	if err != nil {
+		logger.Error(err, "查询 basic 认证用户 Secret: 失败", "secret", sourceName)
+		return err
+	}
+
+	newSecret, err := k8s.NewBasicAuthSecret(obj, &source)
+	if err != nil {
+		logger.Info("生成 htpasswd 失败", "secret", sourceName, "error", err.Error())
+		r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "InvalidBasicAuth", "生成 htpasswd 失败: %s", err)
+		return nil
+	}
+
+	var currentSecret coreV1.Secret
+	err = r.Client.Get(ctx, types.NamespacedName{Name: newSecret.Name, Namespace: newSecret.Namespace}, &currentSecret)
+	if errors.IsNotFound(err) {
+		logger.Info("新建 Nginx basic 认证 Secret", "child", newSecret.Name)
+		return r.createChild(ctx, newSecret)
+	}
+	if err != nil {
+		logger.Error(err, "查询 Nginx basic 认证 Secret: 失败")
+		return err
+	}
+
+	if reflect.DeepEqual(currentSecret.Data, newSecret.Data) &&
+		reflect.DeepEqual(currentSecret.Labels, newSecret.Labels) {
+		return nil
+	}
+
+	logger.Info("更新 Nginx basic 认证 Secret", "child", newSecret.Name, "revision", currentSecret.ResourceVersion)
+	newSecret.ResourceVersion = currentSecret.ResourceVersion
+	return r.updateChild(ctx, newSecret)
+}
+
+// basicAuthSourceSecretIndex 按引用的 basic 认证用户 Secret 名称索引 Nginx 实例
+const basicAuthSourceSecretIndex = ".spec.auth.basic.secretName"
+
+func indexBasicAuthSourceSecret(obj client.Object) []string {
+	if name := k8s.GetBasicAuthSourceSecretName(obj.(*devopsV1.Nginx)); name != "" {
+		return []string{name}
+	}
+	return nil
+}
+
+// nginxForSecret 用户 Secret 变化时, 通过索引查询并重新调谐引用它的 Nginx 实例
+func (r *NginxReconciler) nginxForSecret(secret client.Object) []reconcile.Request {
+	var nginxList devopsV1.NginxList
+	err := r.Client.List(context.Background(), &nginxList, client.InNamespace(secret.GetNamespace()),
+		client.MatchingFields{basicAuthSourceSecretIndex: secret.GetName()})
+	if err != nil {
+		r.Log.Error(err, "查询引用 Secret 的 Nginx 实例: 失败", "secret", secret.GetName(), "namespace", secret.GetNamespace())
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range nginxList.Items {
+		if n := &nginxList.Items[i]; r.shouldManageNginx(n) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(n)})
+		}
+	}
+	return requests
+}
+
+// sourceObjectPredicate 只处理可能被引用的用户 Secret 和 ConfigMap: operator 创建的子资源由 Owns 处理.
+// Secret 和 ConfigMap 只监听元数据, 定期同步的 resourceVersion 不变, 不重复调谐
+func sourceObjectPredicate() predicate.Funcs {
+	isSource := func(obj client.Object) bool {
+		owner := metaV1.GetControllerOf(obj)
+		return owner == nil || owner.Kind != devopsV1.Kind
+	}
+	return predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return isSource(e.Object) },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return isSource(e.Object) },
+		GenericFunc: func(e event.GenericEvent) bool { return isSource(e.Object) },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return isSource(e.ObjectNew) && e.ObjectOld.GetResourceVersion() != e.ObjectNew.GetResourceVersion()
+		},
+	}
+}
+
+// configMapConfigIndex 按 ConfigMap 类型配置引用的 ConfigMap 名称索引 Nginx 实例
+const configMapConfigIndex = ".spec.config.name"
+
+func indexConfigMapConfig(obj client.Object) []string {
+	if name := k8s.GetConfigMapConfigName(obj.(*devopsV1.Nginx)); name != "" {
+		return []string{name}
+	}
+	return nil
+}
+
+// nginxForConfigMap 用户 ConfigMap 变化时, 重新检查引用它作为配置的 Nginx 实例
+func (r *NginxReconciler) nginxForConfigMap(configMap client.Object) []reconcile.Request {
+	var nginxList devopsV1.NginxList
+	err := r.Client.List(context.Background(), &nginxList, client.InNamespace(configMap.GetNamespace()),
+		client.MatchingFields{configMapConfigIndex: configMap.GetName()})
+	if err != nil {
+		r.Log.Error(err, "查询引用 ConfigMap 的 Nginx 实例: 失败", "configMap", configMap.GetName(), "namespace", configMap.GetNamespace())
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range nginxList.Items {
+		if n := &nginxList.Items[i]; r.shouldManageNginx(n) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(n)})
+		}
+	}
+	return requests
+}
+
+// reconcileConfigIncludes 检查 ConfigMap 类型配置是否引用了生成的配置片段. 用户需要手动添加 include,
+// 缺少时认证, 限流, WAF 和维护模式不会生效, 通过 condition 和事件提示
+func (r *NginxReconciler) reconcileConfigIncludes(ctx context.Context, obj *devopsV1.Nginx) error {
+	logger := r.loggerFrom(ctx, "reconcileConfigIncludes")
+
+	configName := k8s.GetConfigMapConfigName(obj)
+	if configName == "" || !k8s.HasGeneratedConfig(obj) {
+		meta.RemoveStatusCondition(&obj.Status.Conditions, devopsV1.ConditionTypeGeneratedConfigIncluded)
+		return nil
+	}
+
+	condition := metaV1.Condition{
+		Type:               devopsV1.ConditionTypeGeneratedConfigIncluded,
+		Status:             metaV1.ConditionTrue,
+		ObservedGeneration: obj.Generation,
+		Reason:             "Included",
+		Message:            fmt.Sprintf("ConfigMap %s includes the generated config", configName),
+	}
+	var configMap coreV1.ConfigMap
+	err := r.apiReader().Get(ctx, types.NamespacedName{Name: configName, Namespace: obj.Namespace}, &configMap)
+	switch {
+	case errors.IsNotFound(err):
+		// ConfigMap 不存在时 Pod 无法启动, 不需要额外的事件
+		condition.Status = metaV1.ConditionUnknown
+		condition.Reason = "ConfigMapNotFound"
+		condition.Message = fmt.Sprintf("ConfigMap %s not found", configName)
+	case err != nil:
+		logger.Error(err, "查询 ConfigMap 配置: 失败", "configMap", configName)
+		return err
+	default:
+		if missing := k8s.GetMissingIncludes(obj, &configMap); len(missing) > 0 {
+			condition.Status = metaV1.ConditionFalse
+			condition.Reason = "IncludeMissing"
+			condition.Message = fmt.Sprintf("nginx.conf in ConfigMap %s is missing: %s", configName, strings.Join(missing, " "))
+
+			// 只在结果变化时产生事件, 避免每次调谐重复提示
+			previous := meta.FindStatusCondition(obj.Status.Conditions, devopsV1.ConditionTypeGeneratedConfigIncluded)
+			if previous == nil || previous.Status != condition.Status || previous.Message != condition.Message {
+				logger.Info("ConfigMap 配置没有引用生成的配置", "configMap", configName, "missing", missing)
+				r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "GeneratedConfigNotIncluded",
+					"ConfigMap %s 的 nginx.conf 缺少 %s, 生成的配置不会生效", configName, strings.Join(missing, " "))
+			}
+		}
+	}
+	meta.SetStatusCondition(&obj.Status.Conditions, condition)
+	return nil
+}
+
+// apiReader 读取不在缓存中的资源(例如 Namespace), 未设置时使用 Client
+func (r *NginxReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// reconcilePodSecurity 创建工作负载前按照命名空间 enforce 的 Pod Security Standards 级别检查 Pod 模板,
+// 通过 condition 和事件提示违规项, 避免只能在 ReplicaSet 上看到准入失败
+func (r *NginxReconciler) reconcilePodSecurity(ctx context.Context, obj *devopsV1.Nginx) error {
+	logger := r.loggerFrom(ctx, "reconcilePodSecurity")
+
+	var namespace coreV1.Namespace
+	if err := r.apiReader().Get(ctx, types.NamespacedName{Name: obj.Namespace}, &namespace); err != nil {
+		// 只有命名空间级别权限时无法读取 Namespace, 不影响调谐
+		logger.V(1).Info("查询命名空间: 失败, 跳过 Pod Security Standards 检查", "error", err.Error())
+		meta.SetStatusCondition(&obj.Status.Conditions, metaV1.Condition{
+			Type:               devopsV1.ConditionTypePodSecurityCompliant,
+			Status:             metaV1.ConditionUnknown,
+			ObservedGeneration: obj.Generation,
+			Reason:             "NamespaceUnavailable",
+			Message:            fmt.Sprintf("cannot read namespace %s", obj.Namespace),
+		})
+		return nil
+	}
+
+	result := k8s.CheckPodSecurity(namespace.Labels, k8s.GetPodTemplate(obj))
+	condition := metaV1.Condition{
+		Type:               devopsV1.ConditionTypePodSecurityCompliant,
+		Status:             metaV1.ConditionTrue,
+		ObservedGeneration: obj.Generation,
+		Reason:             "Compliant",
+		Message:            fmt.Sprintf("pod template satisfies %s:%s", result.Level, result.Version),
+	}
+	if !result.Allowed {
+		condition.Status = metaV1.ConditionFalse
+		condition.Reason = "Violation"
+		condition.Message = fmt.Sprintf("violates %s:%s: %s", result.Level, result.Version, strings.Join(result.Violations, ", "))
+
+		// 只在结果变化时产生事件, 避免每次调谐重复提示
+		previous := meta.FindStatusCondition(obj.Status.Conditions, devopsV1.ConditionTypePodSecurityCompliant)
+		if previous == nil || previous.Status != condition.Status || previous.Message != condition.Message {
+			logger.Info("Pod 模板不满足命名空间的 Pod Security Standards", "level", result.Level, "violations", result.Violations)
+			r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "PodSecurityViolation",
+				"Pod 模板不满足命名空间 %s 的 %s 级别: %s", obj.Namespace, result.Level, strings.Join(result.Violations, ", "))
+		}
+	}
+	meta.SetStatusCondition(&obj.Status.Conditions, condition)
 	return nil
 }
 
-func (r *NginxReconciler) reconcileDeployment(ctx context.Context, obj *devopsV1.Nginx) error {
-	logger := r.Log.WithName("reconcileDeployment").WithValues("命名空间", obj.Namespace)
+func (r *NginxReconciler) reconcileWorkload(ctx context.Context, obj *devopsV1.Nginx) error {
+	switch k8s.GetWorkloadKind(obj) {
+	case devopsV1.WorkloadKindDaemonSet:
+		if err := r.reconcileDaemonSet(ctx, obj); err != nil {
+			return err
+		}
+	case devopsV1.WorkloadKindStatefulSet:
+		if err := r.reconcileStatefulSet(ctx, obj); err != nil {
+			return err
+		}
+	default:
+		if err := r.reconcileDeployment(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return r.reconcileHeadlessService(ctx, obj)
+}
+
+func (r *NginxReconciler) reconcileDeployment(ctx context.Context, obj *devopsV1.Nginx) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileDeployment", obj)
+	defer func() { endSpan(span, err) }()
+
+	logger := r.loggerFrom(ctx, "reconcileDeployment")
 
 	newDeploy, err := k8s.NewDeployment(obj)
 	if err != nil {
-		logger.Error(err, "构建 Nginx Deployment 失败: ")
+		logger.Error(err, "构建 Nginx Deployment 失败")
 		return fmt.Errorf("构建 Nginx Deployment 失败: %w", err)
 	}
 
-	logger.Info("查询 Nginx Deployment 实例: 开始")
+	logger.V(1).Info("查询 Nginx Deployment 实例: 开始", "child", newDeploy.Name)
 	var currentDeploy appsV1.Deployment
 	err = r.Client.Get(ctx, types.NamespacedName{Name: newDeploy.Name, Namespace: newDeploy.Namespace}, &currentDeploy)
 	if errors.IsNotFound(err) {
-		logger.Info("查询 Nginx Deployment 实例: 不存在")
-		logger.Info("新建 Nginx Deployment 实例：开始")
-		return r.Client.Create(ctx, newDeploy)
+		logger.Info("新建 Nginx Deployment 实例", "child", newDeploy.Name)
+		if k8s.IsAutoscalingEnabled(obj) {
+			// 开启自动扩缩容时，以最小副本数创建，之后交由 HPA 管理
+			newDeploy.Spec.Replicas = k8s.GetHorizontalPodAutoscalerMinReplicas(obj)
+		}
+		return r.createChild(ctx, newDeploy)
 	}
 
 	if err != nil {
@@ -315,13 +901,13 @@ func (r *NginxReconciler) reconcileDeployment(ctx context.Context, obj *devopsV1
 		return fmt.Errorf("不能获取 Deployment: %w", err)
 	}
 
-	//logger.Info("查询 Nginx Deployment 实例: 成功","详情", currentDeploy)
 	// 查询一下pod信息
-	err = r.listPods(ctx, obj)
+	_, err = r.listPods(ctx, obj)
 	if err != nil {
 		logger.Error(err, "查询 Nginx Pod 列表: 失败")
 	}
 
+	// 未设置副本数(或开启了自动扩缩容)时，保留当前副本数，避免与 HPA 冲突
 	replicas := currentDeploy.Spec.Replicas
 
 	patch := client.StrategicMergeFrom(currentDeploy.DeepCopy())
@@ -336,44 +922,204 @@ func (r *NginxReconciler) reconcileDeployment(ctx context.Context, obj *devopsV1
 		}
 	}
 
-	err = r.Client.Patch(ctx, &currentDeploy, patch)
+	err = r.patchChild(ctx, &currentDeploy, patch)
 	if err != nil {
-		logger.Error(err, "Patch Nginx deployment: 失败")
+		logger.Error(err, "Patch Nginx deployment: 失败", "child", currentDeploy.Name, "revision", currentDeploy.ResourceVersion)
 		return fmt.Errorf("failed to patch Deployment: %w", err)
 	}
 
 	return nil
 }
 
-func (r *NginxReconciler) reconcileService(ctx context.Context, obj *devopsV1.Nginx) error {
-	logger := r.Log.WithName("reconcileService").WithValues("命名空间", obj.Namespace)
+func (r *NginxReconciler) reconcileDaemonSet(ctx context.Context, obj *devopsV1.Nginx) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileDaemonSet", obj)
+	defer func() { endSpan(span, err) }()
+
+	logger := r.loggerFrom(ctx, "reconcileDaemonSet")
+
+	newDaemonSet, err := k8s.NewDaemonSet(obj)
+	if err != nil {
+		logger.Error(err, "构建 Nginx DaemonSet 失败")
+		return fmt.Errorf("构建 Nginx DaemonSet 失败: %w", err)
+	}
+
+	logger.V(1).Info("查询 Nginx DaemonSet 实例: 开始", "child", newDaemonSet.Name)
+	var currentDaemonSet appsV1.DaemonSet
+	err = r.Client.Get(ctx, types.NamespacedName{Name: newDaemonSet.Name, Namespace: newDaemonSet.Namespace}, &currentDaemonSet)
+	if errors.IsNotFound(err) {
+		logger.Info("新建 Nginx DaemonSet 实例", "child", newDaemonSet.Name)
+		return r.createChild(ctx, newDaemonSet)
+	}
+
+	if err != nil {
+		logger.Error(err, "查询 Nginx DaemonSet 实例: 失败")
+		return fmt.Errorf("不能获取 DaemonSet: %w", err)
+	}
+
+	// 查询一下pod信息
+	_, err = r.listPods(ctx, obj)
+	if err != nil {
+		logger.Error(err, "查询 Nginx Pod 列表: 失败")
+	}
+
+	patch := client.StrategicMergeFrom(currentDaemonSet.DeepCopy())
+	currentDaemonSet.Spec = newDaemonSet.Spec
+
+	err = r.patchChild(ctx, &currentDaemonSet, patch)
+	if err != nil {
+		logger.Error(err, "Patch Nginx daemonset: 失败", "child", currentDaemonSet.Name, "revision", currentDaemonSet.ResourceVersion)
+		return fmt.Errorf("failed to patch DaemonSet: %w", err)
+	}
+
+	return nil
+}
+
+func (r *NginxReconciler) reconcileStatefulSet(ctx context.Context, obj *devopsV1.Nginx) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileStatefulSet", obj)
+	defer func() { endSpan(span, err) }()
+
+	logger := r.loggerFrom(ctx, "reconcileStatefulSet")
+
+	newStatefulSet, err := k8s.NewStatefulSet(obj)
+	if err != nil {
+		logger.Error(err, "构建 Nginx StatefulSet 失败")
+		return fmt.Errorf("构建 Nginx StatefulSet 失败: %w", err)
+	}
+
+	logger.V(1).Info("查询 Nginx StatefulSet 实例: 开始", "child", newStatefulSet.Name)
+	var currentStatefulSet appsV1.StatefulSet
+	err = r.Client.Get(ctx, types.NamespacedName{Name: newStatefulSet.Name, Namespace: newStatefulSet.Namespace}, &currentStatefulSet)
+	if errors.IsNotFound(err) {
+		logger.Info("新建 Nginx StatefulSet 实例", "child", newStatefulSet.Name)
+		if k8s.IsAutoscalingEnabled(obj) {
+			newStatefulSet.Spec.Replicas = k8s.GetHorizontalPodAutoscalerMinReplicas(obj)
+		}
+		return r.createChild(ctx, newStatefulSet)
+	}
+
+	if err != nil {
+		logger.Error(err, "查询 Nginx StatefulSet 实例: 失败")
+		return fmt.Errorf("不能获取 StatefulSet: %w", err)
+	}
+
+	// 查询一下pod信息
+	_, err = r.listPods(ctx, obj)
+	if err != nil {
+		logger.Error(err, "查询 Nginx Pod 列表: 失败")
+	}
+
+	// VolumeClaimTemplates 创建后不可修改，需要用户删除 StatefulSet 后重建
+	if !equality.Semantic.DeepDerivative(newStatefulSet.Spec.VolumeClaimTemplates, currentStatefulSet.Spec.VolumeClaimTemplates) {
+		logger.Info("StatefulSet 缓存卷模板不可修改: 忽略缓存卷的变更", "child", currentStatefulSet.Name)
+		r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "CacheVolumeImmutable", "StatefulSet 缓存卷模板不可修改, 请删除 StatefulSet 后重建")
+	}
+
+	replicas := currentStatefulSet.Spec.Replicas
+
+	// 只更新 StatefulSet 中允许修改的字段
+	patch := client.StrategicMergeFrom(currentStatefulSet.DeepCopy())
+	currentStatefulSet.Spec.Template = newStatefulSet.Spec.Template
+	currentStatefulSet.Spec.UpdateStrategy = newStatefulSet.Spec.UpdateStrategy
+	currentStatefulSet.Spec.MinReadySeconds = newStatefulSet.Spec.MinReadySeconds
+	currentStatefulSet.Spec.Replicas = newStatefulSet.Spec.Replicas
+
+	if newStatefulSet.Spec.Replicas == nil {
+		if replicas == nil {
+			defaultReplicas := int32(1)
+			currentStatefulSet.Spec.Replicas = &defaultReplicas
+		} else {
+			currentStatefulSet.Spec.Replicas = replicas
+		}
+	}
+
+	err = r.patchChild(ctx, &currentStatefulSet, patch)
+	if err != nil {
+		logger.Error(err, "Patch Nginx statefulset: 失败", "child", currentStatefulSet.Name, "revision", currentStatefulSet.ResourceVersion)
+		return fmt.Errorf("failed to patch StatefulSet: %w", err)
+	}
+
+	return nil
+}
+
+// reconcileHeadlessService StatefulSet 模式下维护 headless Service, 其他模式下删除
+func (r *NginxReconciler) reconcileHeadlessService(ctx context.Context, obj *devopsV1.Nginx) error {
+	logger := r.loggerFrom(ctx, "reconcileHeadlessService")
 
-	newService := k8s.NewService(obj)
+	newService := k8s.NewHeadlessService(obj)
+	isStatefulSet := k8s.GetWorkloadKind(obj) == devopsV1.WorkloadKindStatefulSet
+
+	var currentService coreV1.Service
+	err := r.Client.Get(ctx, types.NamespacedName{Name: newService.Name, Namespace: newService.Namespace}, &currentService)
+	if errors.IsNotFound(err) {
+		if !isStatefulSet {
+			return nil
+		}
+		logger.Info("新建 Nginx Headless Service 实例", "child", newService.Name)
+		return r.createChild(ctx, newService)
+	}
+
+	if err != nil {
+		logger.Error(err, "查询 Nginx Headless Service 实例: 失败")
+		return err
+	}
+
+	// 非 StatefulSet 模式下多余的 Headless Service 由 pruneChildren 删除
+	if !isStatefulSet {
+		return nil
+	}
+
+	if reflect.DeepEqual(currentService.Labels, newService.Labels) &&
+		equality.Semantic.DeepDerivative(newService.Spec, currentService.Spec) {
+		return nil
+	}
+
+	logger.Info("更新 Nginx Headless Service", "child", currentService.Name, "revision", currentService.ResourceVersion)
+	patch := client.MergeFrom(currentService.DeepCopy())
+	currentService.Labels = newService.Labels
+	currentService.Spec.Ports = newService.Spec.Ports
+	currentService.Spec.Selector = newService.Spec.Selector
+	return r.patchChild(ctx, &currentService, patch)
+}
+
+// reconcileService 维护 spec.services 中的每个 Service, 从列表中移除的 Service 由 pruneChildren 删除
+func (r *NginxReconciler) reconcileService(ctx context.Context, obj *devopsV1.Nginx) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileService", obj)
+	defer func() { endSpan(span, err) }()
+
+	for _, service := range k8s.GetServices(obj) {
+		if err = r.reconcileOneService(ctx, obj, k8s.NewService(obj, service)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *NginxReconciler) reconcileOneService(ctx context.Context, obj *devopsV1.Nginx, newService *coreV1.Service) (err error) {
+	logger := r.loggerFrom(ctx, "reconcileService")
 
 	var currentService coreV1.Service
 	var namespace = types.NamespacedName{Name: newService.Name, Namespace: newService.Namespace}
 
-	logger.Info("查询 Nginx Service 实例: 开始")
-	err := r.Client.Get(ctx, namespace, &currentService)
+	logger.V(1).Info("查询 Nginx Service 实例: 开始", "child", newService.Name)
+	err = r.Client.Get(ctx, namespace, &currentService)
 
 	if errors.IsNotFound(err) {
-		logger.Info("查询 Nginx Service 实例: 不存在")
-		logger.Info("新建 Nginx Service 实例：开始")
+		logger.Info("新建 Nginx Service 实例", "child", newService.Name)
 
-		err = r.Client.Create(ctx, newService)
+		err = r.createChild(ctx, newService)
 		if errors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota") {
 			logger.Error(err, "新建 Nginx Service 实例：失败")
-			r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "ServiceQuotaExceeded", "创建服务失败: %s", err)
+			r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "ServiceQuotaExceeded", "创建服务 %s 失败: %s", newService.Name, err)
 			return err
 		}
 
 		if err != nil {
 			logger.Error(err, "新建 Nginx Service 实例：失败")
-			r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "ServiceCreationFailed", "创建服务失败: %s", err)
+			r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "ServiceCreationFailed", "创建服务 %s 失败: %s", newService.Name, err)
 			return err
 		}
-		logger.Info("新建 Nginx Service 实例：成功")
-		r.EventRecorder.Eventf(obj, coreV1.EventTypeNormal, "ServiceCreated", "创建服务成功")
+		logger.V(1).Info("新建 Nginx Service 实例：成功", "child", newService.Name, "revision", newService.ResourceVersion)
+		r.EventRecorder.Eventf(obj, coreV1.EventTypeNormal, "ServiceCreated", "创建服务 %s 成功", newService.Name)
 		return nil
 	}
 
@@ -381,7 +1127,6 @@ func (r *NginxReconciler) reconcileService(ctx context.Context, obj *devopsV1.Ng
 		logger.Error(err, "查询 Nginx Service 实例: 失败")
 		return fmt.Errorf("查询Service服务失败: %v", err)
 	}
-	//logger.Info("查询 Nginx Service 实例: 结束","详情", currentService)
 
 	newService.ResourceVersion = currentService.ResourceVersion
 	newService.Spec.ClusterIP = currentService.Spec.ClusterIP
@@ -405,16 +1150,98 @@ func (r *NginxReconciler) reconcileService(ctx context.Context, obj *devopsV1.Ng
 		}
 	}
 
-	err = r.Client.Update(ctx, newService)
+	err = r.updateChild(ctx, newService)
 	if err != nil {
-		r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "ServiceUpdateFailed", "更新服务失败: %s", err)
+		r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "ServiceUpdateFailed", "更新服务 %s 失败: %s", newService.Name, err)
 		return err
 	}
 
-	r.EventRecorder.Eventf(obj, coreV1.EventTypeNormal, "ServiceUpdated", "更新服务成功")
+	r.EventRecorder.Eventf(obj, coreV1.EventTypeNormal, "ServiceUpdated", "更新服务 %s 成功", newService.Name)
 	return nil
 }
 
+func shouldUpdateHorizontalPodAutoscaler(currentHPA, newHPA *autoscalingV2.HorizontalPodAutoscaler) bool {
+	if currentHPA == nil || newHPA == nil {
+		return false
+	}
+	// 忽略 API Server 填充的默认值(例如 behavior)
+	return !reflect.DeepEqual(currentHPA.Labels, newHPA.Labels) ||
+		!equality.Semantic.DeepDerivative(newHPA.Spec, currentHPA.Spec)
+}
+
+func (r *NginxReconciler) reconcileHorizontalPodAutoscaler(ctx context.Context, obj *devopsV1.Nginx) error {
+	logger := r.loggerFrom(ctx, "reconcileHorizontalPodAutoscaler")
+
+	logger.V(1).Info("查询 Nginx HorizontalPodAutoscaler 实例: 开始")
+	newHPA := k8s.NewHorizontalPodAutoscaler(obj)
+	var currentHPA autoscalingV2.HorizontalPodAutoscaler
+
+	err := r.Client.Get(ctx, types.NamespacedName{Name: newHPA.Name, Namespace: newHPA.Namespace}, &currentHPA)
+	if errors.IsNotFound(err) {
+		logger.V(1).Info("查询 Nginx HorizontalPodAutoscaler 实例: 不存在", "child", newHPA.Name)
+		if !k8s.IsAutoscalingEnabled(obj) {
+			logger.V(1).Info("CRD实例YAML配置文件未配置Autoscaling: 忽略HorizontalPodAutoscaler的操作")
+			return nil
+		}
+
+		logger.Info("创建 Nginx HorizontalPodAutoscaler 实例", "child", newHPA.Name)
+		return r.createChild(ctx, newHPA)
+	}
+
+	if err != nil {
+		logger.Error(err, "查询 Nginx HorizontalPodAutoscaler 实例: 失败")
+		return err
+	}
+
+	// 未配置 Autoscaling 时, 多余的 HorizontalPodAutoscaler 由 pruneChildren 删除
+	if !k8s.IsAutoscalingEnabled(obj) {
+		return nil
+	}
+
+	logger.V(1).Info("验证 Nginx CRD 实例，是否更新了 Autoscaling")
+	if !shouldUpdateHorizontalPodAutoscaler(&currentHPA, newHPA) {
+		return nil
+	}
+
+	logger.Info("更新 Nginx HorizontalPodAutoscaler", "child", currentHPA.Name, "revision", currentHPA.ResourceVersion)
+	newHPA.ResourceVersion = currentHPA.ResourceVersion
+	newHPA.Finalizers = currentHPA.Finalizers
+	return r.updateChild(ctx, newHPA)
+}
+
+func (r *NginxReconciler) reconcileNetworkPolicy(ctx context.Context, obj *devopsV1.Nginx) error {
+	logger := r.loggerFrom(ctx, "reconcileNetworkPolicy")
+
+	// 未开启 NetworkPolicy 时, 多余的 NetworkPolicy 由 pruneChildren 删除
+	if !k8s.IsNetworkPolicyEnabled(obj) {
+		logger.V(1).Info("CRD实例YAML配置文件未开启NetworkPolicy: 忽略NetworkPolicy的操作")
+		return nil
+	}
+
+	newPolicy := k8s.NewNetworkPolicy(obj)
+	var currentPolicy networkingV1.NetworkPolicy
+	err := r.Client.Get(ctx, types.NamespacedName{Name: newPolicy.Name, Namespace: newPolicy.Namespace}, &currentPolicy)
+	if errors.IsNotFound(err) {
+		logger.Info("创建 Nginx NetworkPolicy 实例", "child", newPolicy.Name)
+		return r.createChild(ctx, newPolicy)
+	}
+
+	if err != nil {
+		logger.Error(err, "查询 Nginx NetworkPolicy 实例: 失败")
+		return err
+	}
+
+	if reflect.DeepEqual(currentPolicy.Labels, newPolicy.Labels) &&
+		equality.Semantic.DeepEqual(currentPolicy.Spec, newPolicy.Spec) {
+		return nil
+	}
+
+	logger.Info("更新 Nginx NetworkPolicy", "child", currentPolicy.Name, "revision", currentPolicy.ResourceVersion)
+	newPolicy.ResourceVersion = currentPolicy.ResourceVersion
+	newPolicy.Finalizers = currentPolicy.Finalizers
+	return r.updateChild(ctx, newPolicy)
+}
+
 func shouldUpdateIngress(currentIngress, newIngress *networkingV1.Ingress) bool {
 	if currentIngress == nil || newIngress == nil {
 		return false
@@ -424,50 +1251,206 @@ func shouldUpdateIngress(currentIngress, newIngress *networkingV1.Ingress) bool
 		!reflect.DeepEqual(currentIngress.Spec, newIngress.Spec)
 }
 
-func (r *NginxReconciler) reconcileIngress(ctx context.Context, obj *devopsV1.Nginx) error {
-	logger := r.Log.WithName("reconcileIngress").WithValues("命名空间", obj.Namespace)
+// reconcileOAuth2ProxyIngress 在 Ingress 上进行 OIDC 认证时, 维护将登录路径转发到 oauth2-proxy 的 Ingress
+func (r *NginxReconciler) reconcileOAuth2ProxyIngress(ctx context.Context, obj *devopsV1.Nginx) error {
+	logger := r.loggerFrom(ctx, "reconcileOAuth2ProxyIngress")
+
+	// 不再需要时, 多余的 Ingress 由 pruneChildren 删除
+	if ingressprofile.IngressOIDCAuth(obj) == nil {
+		return nil
+	}
+
+	newIngress := k8s.NewOAuth2ProxyIngress(obj)
+	var currentIngress networkingV1.Ingress
+	err := r.Client.Get(ctx, types.NamespacedName{Name: newIngress.Name, Namespace: newIngress.Namespace}, &currentIngress)
+	if errors.IsNotFound(err) {
+		logger.Info("创建 oauth2-proxy Ingress 实例", "child", newIngress.Name)
+		return r.createChild(ctx, newIngress)
+	}
+	if err != nil {
+		logger.Error(err, "查询 oauth2-proxy Ingress 实例: 失败")
+		return err
+	}
+
+	if !shouldUpdateIngress(&currentIngress, newIngress) {
+		return nil
+	}
+
+	logger.Info("更新 oauth2-proxy Ingress", "child", currentIngress.Name, "revision", currentIngress.ResourceVersion)
+	newIngress.ResourceVersion = currentIngress.ResourceVersion
+	return r.updateChild(ctx, newIngress)
+}
+
+func (r *NginxReconciler) reconcileIngress(ctx context.Context, obj *devopsV1.Nginx) (err error) {
+	ctx, span := r.startSpan(ctx, "reconcileIngress", obj)
+	defer func() { endSpan(span, err) }()
+
+	logger := r.loggerFrom(ctx, "reconcileIngress")
 
 	if obj == nil {
 		return fmt.Errorf("nginx cannot be nil")
 	}
 
-	logger.Info("查询 Nginx Ingress 实例: 开始")
+	logger.V(1).Info("查询 Nginx Ingress 实例: 开始")
 	newIngress := k8s.NewIngress(obj)
 	var currentIngress networkingV1.Ingress
 
-	err := r.Client.Get(ctx, types.NamespacedName{Name: newIngress.Name, Namespace: newIngress.Namespace}, &currentIngress)
+	err = r.Client.Get(ctx, types.NamespacedName{Name: newIngress.Name, Namespace: newIngress.Namespace}, &currentIngress)
 	if errors.IsNotFound(err) {
-		logger.Info("查询 Nginx Ingress 实例: 不存在")
+		logger.V(1).Info("查询 Nginx Ingress 实例: 不存在", "child", newIngress.Name)
 		if obj.Spec.Ingress == nil {
-			logger.Info("CRD实例YAML配置文件未配置Ingress: 忽略Ingress的操作")
+			logger.V(1).Info("CRD实例YAML配置文件未配置Ingress: 忽略Ingress的操作")
 			return nil
 		}
 
-		logger.Info("创建 Nginx Ingress 实例")
-		return r.Client.Create(ctx, newIngress)
+		logger.Info("创建 Nginx Ingress 实例", "child", newIngress.Name)
+		r.warnUnsupportedIngressFeatures(obj)
+		return r.createChild(ctx, newIngress)
 	}
 
 	if err != nil {
 		logger.Error(err, "查询 Nginx Ingress 实例: 失败")
 		return err
 	}
-	//logger.Info("查询 Nginx Ingress 实例: 结束","详情",currentIngress)
 
-	logger.Info("查询 Nginx CRD 实例，是否配置了 Ingress")
+	logger.V(1).Info("查询 Nginx CRD 实例，是否配置了 Ingress")
+	// 未配置 Ingress 时, 多余的 Ingress 由 pruneChildren 删除
 	if obj.Spec.Ingress == nil {
-		logger.Info("CRD实例YAML配置文件未配置Ingress: 删除多余的Ingress")
-		return r.Client.Delete(ctx, &currentIngress)
+		return nil
 	}
 
-	logger.Info("验证 Nginx CRD 实例，是否更新了 Ingress")
+	logger.V(1).Info("验证 Nginx CRD 实例，是否更新了 Ingress")
 	if !shouldUpdateIngress(&currentIngress, newIngress) {
 		return nil
 	}
 
-	logger.Info("更新 Nginx Ingress")
+	logger.Info("更新 Nginx Ingress", "child", currentIngress.Name, "revision", currentIngress.ResourceVersion)
 	newIngress.ResourceVersion = currentIngress.ResourceVersion
 	newIngress.Finalizers = currentIngress.Finalizers
-	return r.Client.Update(ctx, newIngress)
+	r.warnUnsupportedIngressFeatures(obj)
+	return r.updateChild(ctx, newIngress)
+}
+
+// warnUnsupportedIngressFeatures 所选 ingress 控制器不支持的 features 会被忽略, 通过事件提示用户
+func (r *NginxReconciler) warnUnsupportedIngressFeatures(obj *devopsV1.Nginx) {
+	if unsupported := k8s.GetUnsupportedIngressFeatures(obj); len(unsupported) > 0 {
+		r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "IngressFeatureUnsupported",
+			"%s 不支持以下 ingress features, 已忽略: %s", obj.Spec.Ingress.Profile, strings.Join(unsupported, ", "))
+	}
+}
+
+// reconcileIngressFeatureObjects 维护 ingress features 需要的额外资源(例如 Traefik Middleware), 集群未安装其 CRD 时跳过
+func (r *NginxReconciler) reconcileIngressFeatureObjects(ctx context.Context, obj *devopsV1.Nginx) error {
+	logger := r.loggerFrom(ctx, "reconcileIngressFeatureObjects")
+
+	desired := map[schema.GroupVersionKind][]*unstructured.Unstructured{}
+	for _, object := range k8s.GetIngressFeatureObjects(obj) {
+		gvk := object.GroupVersionKind()
+		desired[gvk] = append(desired[gvk], object)
+	}
+
+	for _, gvk := range ingressprofile.ObjectKinds {
+		if _, err := r.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			if !meta.IsNoMatchError(err) {
+				return err
+			}
+			if len(desired[gvk]) > 0 {
+				logger.Info("集群未安装 ingress features 需要的 CRD: 忽略", "kind", gvk.Kind)
+				r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "IngressFeatureUnavailable", "集群未安装 %s CRD, 无法创建 ingress features 需要的资源", gvk.GroupKind())
+			}
+			continue
+		}
+
+		var currentList unstructured.UnstructuredList
+		currentList.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		err := r.Client.List(ctx, &currentList, client.InNamespace(obj.Namespace), client.MatchingLabels(k8s.LabelsForNginx(obj.Name)))
+		if err != nil {
+			logger.Error(err, "查询 ingress features 资源: 失败", "kind", gvk.Kind)
+			return err
+		}
+		current := map[string]*unstructured.Unstructured{}
+		for i := range currentList.Items {
+			current[currentList.Items[i].GetName()] = &currentList.Items[i]
+		}
+
+		for _, object := range desired[gvk] {
+			existing, ok := current[object.GetName()]
+			delete(current, object.GetName())
+			if !ok {
+				logger.Info("创建 ingress features 资源", "kind", gvk.Kind, "child", object.GetName())
+				if err := r.createChild(ctx, object); err != nil {
+					return err
+				}
+				continue
+			}
+			if reflect.DeepEqual(existing.GetLabels(), object.GetLabels()) &&
+				equality.Semantic.DeepEqual(existing.Object["spec"], object.Object["spec"]) {
+				continue
+			}
+			logger.Info("更新 ingress features 资源", "kind", gvk.Kind, "child", object.GetName(), "revision", existing.GetResourceVersion())
+			object.SetResourceVersion(existing.GetResourceVersion())
+			if err := r.updateChild(ctx, object); err != nil {
+				return err
+			}
+		}
+
+		for _, stale := range current {
+			if !metaV1.IsControlledBy(stale, obj) {
+				continue
+			}
+			logger.Info("删除不再需要的 ingress features 资源", "kind", gvk.Kind, "child", stale.GetName())
+			if err := r.deleteChild(ctx, stale); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reconcileServiceMonitor 开启监控时维护 Prometheus Operator 的 ServiceMonitor, 集群未安装其 CRD 时跳过
+func (r *NginxReconciler) reconcileServiceMonitor(ctx context.Context, obj *devopsV1.Nginx) error {
+	logger := r.loggerFrom(ctx, "reconcileServiceMonitor")
+
+	gvk := k8s.ServiceMonitorGVK
+	if _, err := r.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		if meta.IsNoMatchError(err) {
+			logger.V(1).Info("集群未安装 ServiceMonitor CRD: 忽略ServiceMonitor的操作")
+			return nil
+		}
+		return err
+	}
+
+	newServiceMonitor := k8s.NewServiceMonitor(obj)
+	currentServiceMonitor := &unstructured.Unstructured{}
+	currentServiceMonitor.SetGroupVersionKind(gvk)
+
+	err := r.Client.Get(ctx, client.ObjectKeyFromObject(newServiceMonitor), currentServiceMonitor)
+	if errors.IsNotFound(err) {
+		if !k8s.IsMonitoringEnabled(obj) {
+			return nil
+		}
+		logger.Info("创建 Nginx ServiceMonitor 实例", "child", newServiceMonitor.GetName())
+		return r.createChild(ctx, newServiceMonitor)
+	}
+
+	if err != nil {
+		logger.Error(err, "查询 Nginx ServiceMonitor 实例: 失败")
+		return err
+	}
+
+	if !k8s.IsMonitoringEnabled(obj) {
+		logger.Info("CRD实例YAML配置文件未开启监控: 删除多余的ServiceMonitor", "child", currentServiceMonitor.GetName())
+		return r.deleteChild(ctx, currentServiceMonitor)
+	}
+
+	if reflect.DeepEqual(currentServiceMonitor.GetLabels(), newServiceMonitor.GetLabels()) &&
+		equality.Semantic.DeepEqual(currentServiceMonitor.Object["spec"], newServiceMonitor.Object["spec"]) {
+		return nil
+	}
+
+	logger.Info("更新 Nginx ServiceMonitor", "child", currentServiceMonitor.GetName(), "revision", currentServiceMonitor.GetResourceVersion())
+	newServiceMonitor.SetResourceVersion(currentServiceMonitor.GetResourceVersion())
+	return r.updateChild(ctx, newServiceMonitor)
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -479,62 +1462,92 @@ func (r *NginxReconciler) reconcileIngress(ctx context.Context, obj *devopsV1.Ng
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.1/pkg/reconcile
-func (r *NginxReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	//logger := log.FromContext(ctx)
-	r.Log.Info(KubeBuilder)
-	r.listNginx(ctx)
-	logger := r.Log.WithName("Reconcile").WithValues("命名空间/名称", req.NamespacedName)
+func (r *NginxReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	ctx, span := r.tracer().Start(ctx, "Reconcile", trace.WithAttributes(
+		attribute.String("nginx.namespace", req.Namespace),
+		attribute.String("nginx.name", req.Name),
+	))
+	defer func() { endSpan(span, err) }()
+
+	// controller-runtime 为每次调谐生成 reconcileID, 直接调用 Reconcile 时(例如测试)自行生成
+	reconcileID := controller.ReconcileIDFromContext(ctx)
+	if reconcileID == "" {
+		reconcileID = uuid.NewUUID()
+	}
+	logger := r.Log.WithValues("nginx", req.Name, "namespace", req.Namespace, "reconcileID", reconcileID)
+	ctx = logr.NewContext(ctx, logger)
+	logger = logger.WithName("Reconcile")
 
 	var instance devopsV1.Nginx
-	logger.Info("查询CRD实例: 开始")
-	err := r.Client.Get(ctx, req.NamespacedName, &instance)
+	logger.V(1).Info("查询CRD实例: 开始")
+	err = r.Client.Get(ctx, req.NamespacedName, &instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			logger.Error(err, "查询CRD实例：失败")
+			logger.V(1).Info("查询CRD实例: 不存在, 已被删除")
+			forgetInstanceMetrics(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		logger.Error(err, "获取不到Nginx资源")
 		return ctrl.Result{}, err
 	}
-	logger.Info("查询CRD实例: 结束", "详情", &instance)
+	logger = logger.WithValues("revision", instance.ResourceVersion)
+	logger.V(1).Info("查询CRD实例: 结束", "generation", instance.Generation)
 
-	logger.Info("判断CRD实例是否匹配 AnnotationFilter: 开始")
+	// 子资源的事件不经过 For 的过滤条件, 这里再判断一次, 不匹配的实例直接忽略, 不再重新入队
 	if !r.shouldManageNginx(&instance) {
-		logger.Error(err, "判断CRD实例是否匹配AnnotationFilter: 失败，终止继续执行")
-		return ctrl.Result{Requeue: true, RequeueAfter: 5 * time.Minute}, nil
+		logger.V(1).Info("CRD实例不匹配过滤条件或不属于当前分片: 忽略")
+		return ctrl.Result{}, nil
 	}
-	logger.Info("判断CRD实例是否匹配 AnnotationFilter: 结束")
 
 	logger.Info("处理CRD实例: 开始")
+	observed := *instance.Status.DeepCopy()
 	if err := r.reconcileNginx(ctx, &instance); err != nil {
 		logger.Error(err, "处理CRD实例: 失败")
 		return ctrl.Result{}, err
 	}
-	logger.Info("处理CRD实例: 结束")
 
-	logger.Info("刷新CRD实例状态：开始")
-	if err := r.refreshStatus(ctx, &instance); err != nil {
+	logger.V(1).Info("刷新CRD实例状态：开始")
+	err = observeReconcilePhase(phaseStatus, func() error { return r.refreshStatus(ctx, &instance, observed) })
+	if err != nil {
 		logger.Error(err, "刷新CRD实例状态: 失败")
 		return ctrl.Result{}, err
 	}
-	logger.Info("刷新CRD实例状态：结束")
 
-	logger.Info("处理CRD实例: 结束", "详情", &instance)
+	logger.Info("处理CRD实例: 结束", "replicas", instance.Status.CurrentReplicas)
 	return ctrl.Result{}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 // owns的一般使用 将 deployment service ingress或者其他资源作为operator应用的子资源，进行生命周期管理
 // 既删除 crd 实例 nginx 时，对应的 deployment service ingress 资源也会删除.
+// Secret 和 ConfigMap 只缓存元数据, 内容不常驻 operator 内存, 读取时直接访问 API server(见 main.go 的 ClientDisableCacheFor).
 func (r *NginxReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	//return ctrl.NewControllerManagedBy(mgr).
 	//	For(&devopsV1.Nginx{}).
 	//	Owns(&appsV1.Deployment{}).
 	//	Complete(r)
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &devopsV1.Nginx{},
+		basicAuthSourceSecretIndex, indexBasicAuthSourceSecret); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &devopsV1.Nginx{},
+		configMapConfigIndex, indexConfigMapConfig); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&devopsV1.Nginx{}).
+		For(&devopsV1.Nginx{}, builder.WithPredicates(predicate.NewPredicateFuncs(r.shouldManageNginx))).
 		Owns(&appsV1.Deployment{}).
+		Owns(&appsV1.DaemonSet{}).
+		Owns(&appsV1.StatefulSet{}).
+		Owns(&autoscalingV2.HorizontalPodAutoscaler{}).
 		Owns(&coreV1.Service{}).
+		Owns(&coreV1.ConfigMap{}, builder.OnlyMetadata).
 		Owns(&networkingV1.Ingress{}).
+		Owns(&networkingV1.NetworkPolicy{}).
+		Owns(&coreV1.Secret{}, builder.OnlyMetadata).
+		Watches(&source.Kind{Type: &coreV1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.nginxForSecret),
+			builder.OnlyMetadata, builder.WithPredicates(sourceObjectPredicate())).
+		Watches(&source.Kind{Type: &coreV1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.nginxForConfigMap),
+			builder.OnlyMetadata, builder.WithPredicates(sourceObjectPredicate())).
 		Complete(r)
 }
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	"github.com/tomoncle/k8s-operator-nginx/pkg/k8s"
+)
+
+var _ = Describe("Nginx pod template passthrough", Ordered, func() {
+	const name = "nginx-podtemplate"
+	key := types.NamespacedName{Name: name, Namespace: "default"}
+
+	runtimeClassName := "gvisor"
+	ndots := "2"
+	runAsUser := int64(101)
+
+	nginx := &devopsV1.Nginx{
+		ObjectMeta: metaV1.ObjectMeta{Name: name, Namespace: key.Namespace},
+		Spec: devopsV1.NginxSpec{
+			Image: "nginx:stable-alpine",
+			PodTemplate: devopsV1.PodTemplateSpec{
+				Env: []coreV1.EnvVar{{Name: "NGINX_ENTRYPOINT_QUIET_LOGS", Value: "1"}},
+				EnvFrom: []coreV1.EnvFromSource{{
+					ConfigMapRef: &coreV1.ConfigMapEnvSource{LocalObjectReference: coreV1.LocalObjectReference{Name: "nginx-env"}},
+				}},
+				Lifecycle: &coreV1.Lifecycle{
+					PreStop: &coreV1.LifecycleHandler{Exec: &coreV1.ExecAction{Command: []string{"sleep", "5"}}},
+				},
+				ImagePullSecrets:  []coreV1.LocalObjectReference{{Name: "registry-credentials"}},
+				PriorityClassName: "high-priority",
+				TopologySpreadConstraints: []coreV1.TopologySpreadConstraint{{
+					MaxSkew:           1,
+					TopologyKey:       "topology.kubernetes.io/zone",
+					WhenUnsatisfiable: coreV1.ScheduleAnyway,
+				}},
+				DNSPolicy: coreV1.DNSNone,
+				DNSConfig: &coreV1.PodDNSConfig{
+					Nameservers: []string{"10.0.0.10"},
+					Options:     []coreV1.PodDNSConfigOption{{Name: "ndots", Value: &ndots}},
+				},
+				PodSecurityContext: &coreV1.PodSecurityContext{RunAsUser: &runAsUser},
+				RuntimeClassName:   &runtimeClassName,
+				HostAliases:        []coreV1.HostAlias{{IP: "10.0.0.20", Hostnames: []string{"upstream.local"}}},
+			},
+		},
+	}
+
+	var template coreV1.PodTemplateSpec
+
+	BeforeAll(func() {
+		ctx := context.Background()
+		Expect(k8sClient.Create(ctx, nginx.DeepCopy())).To(Succeed())
+		DeferCleanup(func() {
+			Expect(k8sClient.Delete(ctx, nginx.DeepCopy())).To(Succeed())
+		})
+
+		r := &NginxReconciler{
+			Client:        k8sClient,
+			EventRecorder: record.NewFakeRecorder(100),
+			Log:           logr.Discard(),
+			Scheme:        scheme.Scheme,
+		}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		var deployment appsV1.Deployment
+		Expect(k8sClient.Get(ctx, key, &deployment)).To(Succeed())
+		template = deployment.Spec.Template
+	})
+
+	nginxContainer := func() coreV1.Container {
+		Expect(template.Spec.Containers).NotTo(BeEmpty())
+		return template.Spec.Containers[0]
+	}
+
+	It("sets env on the nginx container", func() {
+		Expect(nginxContainer().Env).To(ContainElement(coreV1.EnvVar{Name: "NGINX_ENTRYPOINT_QUIET_LOGS", Value: "1"}))
+	})
+
+	It("sets envFrom on the nginx container", func() {
+		Expect(nginxContainer().EnvFrom).To(HaveLen(1))
+		Expect(nginxContainer().EnvFrom[0].ConfigMapRef.Name).To(Equal("nginx-env"))
+	})
+
+	It("sets the preStop lifecycle hook on the nginx container", func() {
+		Expect(nginxContainer().Lifecycle).NotTo(BeNil())
+		Expect(nginxContainer().Lifecycle.PreStop.Exec.Command).To(Equal([]string{"sleep", "5"}))
+	})
+
+	It("sets imagePullSecrets", func() {
+		Expect(template.Spec.ImagePullSecrets).To(Equal([]coreV1.LocalObjectReference{{Name: "registry-credentials"}}))
+	})
+
+	It("sets priorityClassName", func() {
+		Expect(template.Spec.PriorityClassName).To(Equal("high-priority"))
+	})
+
+	It("sets topologySpreadConstraints selecting the nginx pods by default", func() {
+		Expect(template.Spec.TopologySpreadConstraints).To(HaveLen(1))
+		constraint := template.Spec.TopologySpreadConstraints[0]
+		Expect(constraint.TopologyKey).To(Equal("topology.kubernetes.io/zone"))
+		Expect(constraint.LabelSelector).NotTo(BeNil())
+		Expect(constraint.LabelSelector.MatchLabels).To(Equal(k8s.LabelsForNginx(name)))
+	})
+
+	It("sets dnsPolicy and dnsConfig", func() {
+		Expect(template.Spec.DNSPolicy).To(Equal(coreV1.DNSNone))
+		Expect(template.Spec.DNSConfig).NotTo(BeNil())
+		Expect(template.Spec.DNSConfig.Nameservers).To(Equal([]string{"10.0.0.10"}))
+	})
+
+	It("sets the pod-level securityContext", func() {
+		Expect(template.Spec.SecurityContext).NotTo(BeNil())
+		Expect(template.Spec.SecurityContext.RunAsUser).To(Equal(&runAsUser))
+	})
+
+	It("sets runtimeClassName", func() {
+		Expect(template.Spec.RuntimeClassName).To(Equal(&runtimeClassName))
+	})
+
+	It("sets hostAliases", func() {
+		Expect(template.Spec.HostAliases).To(Equal([]coreV1.HostAlias{{IP: "10.0.0.20", Hostnames: []string{"upstream.local"}}}))
+	})
+})
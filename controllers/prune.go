@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	"github.com/tomoncle/k8s-operator-nginx/pkg/k8s"
+	"github.com/tomoncle/k8s-operator-nginx/pkg/k8s/ingressprofile"
+	appsV1 "k8s.io/api/apps/v1"
+	autoscalingV2 "k8s.io/api/autoscaling/v2"
+	coreV1 "k8s.io/api/core/v1"
+	networkingV1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// prunableKinds 参与清理的子资源类型, 需要集群中一定存在的内置资源; CRD 资源(ServiceMonitor, Middleware)由各自的步骤清理
+var prunableKinds = []struct {
+	kind    string
+	newList func() client.ObjectList
+}{
+	{"Deployment", func() client.ObjectList { return &appsV1.DeploymentList{} }},
+	{"DaemonSet", func() client.ObjectList { return &appsV1.DaemonSetList{} }},
+	{"StatefulSet", func() client.ObjectList { return &appsV1.StatefulSetList{} }},
+	{"HorizontalPodAutoscaler", func() client.ObjectList { return &autoscalingV2.HorizontalPodAutoscalerList{} }},
+	{"Service", func() client.ObjectList { return &coreV1.ServiceList{} }},
+	{"ConfigMap", func() client.ObjectList { return &coreV1.ConfigMapList{} }},
+	{"Ingress", func() client.ObjectList { return &networkingV1.IngressList{} }},
+	{"NetworkPolicy", func() client.ObjectList { return &networkingV1.NetworkPolicyList{} }},
+	{"Secret", func() client.ObjectList { return &coreV1.SecretList{} }},
+}
+
+func childKey(kind, name string) string {
+	return fmt.Sprintf("%s/%s", kind, name)
+}
+
+// desiredChildren 返回当前 spec 期望存在的子资源, key 为 "<kind>/<name>"
+func desiredChildren(obj *devopsV1.Nginx) map[string]bool {
+	desired := map[string]bool{}
+	switch k8s.GetWorkloadKind(obj) {
+	case devopsV1.WorkloadKindDaemonSet:
+		desired[childKey("DaemonSet", obj.Name)] = true
+	case devopsV1.WorkloadKindStatefulSet:
+		desired[childKey("StatefulSet", obj.Name)] = true
+		desired[childKey("Service", k8s.NewHeadlessService(obj).Name)] = true
+	default:
+		desired[childKey("Deployment", obj.Name)] = true
+	}
+	if k8s.IsAutoscalingEnabled(obj) {
+		desired[childKey("HorizontalPodAutoscaler", k8s.NewHorizontalPodAutoscaler(obj).Name)] = true
+	}
+	for _, service := range k8s.GetServices(obj) {
+		desired[childKey("Service", k8s.GetServiceName(obj, service.NameSuffix))] = true
+	}
+	if k8s.HasGeneratedConfig(obj) {
+		desired[childKey("ConfigMap", k8s.NewGeneratedConfigMap(obj).Name)] = true
+	}
+	if obj.Spec.Ingress != nil {
+		desired[childKey("Ingress", k8s.NewIngress(obj).Name)] = true
+	}
+	if k8s.IsNetworkPolicyEnabled(obj) {
+		desired[childKey("NetworkPolicy", k8s.NewNetworkPolicy(obj).Name)] = true
+	}
+	if ingressprofile.IngressOIDCAuth(obj) != nil {
+		desired[childKey("Ingress", k8s.NewOAuth2ProxyIngress(obj).Name)] = true
+	}
+	if k8s.IsMaintenanceConfigured(obj) {
+		desired[childKey("ConfigMap", k8s.NewMaintenanceConfigMap(obj).Name)] = true
+	}
+	if k8s.IsBasicAuthEnabled(obj) {
+		desired[childKey("Secret", ingressprofile.BasicAuthSecretName(obj))] = true
+	}
+	return desired
+}
+
+// pruneChildren 删除带有 LabelsForNginx 标签、由当前 CRD 实例管理但不再需要的子资源,
+// 例如旧名称的 Ingress, 从 spec.services 中移除的 Service, 切换工作负载类型后遗留的工作负载
+func (r *NginxReconciler) pruneChildren(ctx context.Context, obj *devopsV1.Nginx) (err error) {
+	ctx, span := r.startSpan(ctx, "pruneChildren", obj)
+	defer func() { endSpan(span, err) }()
+
+	logger := r.loggerFrom(ctx, "pruneChildren")
+	desired := desiredChildren(obj)
+
+	for _, prunable := range prunableKinds {
+		list := prunable.newList()
+		err = r.Client.List(ctx, list, client.InNamespace(obj.Namespace), client.MatchingLabels(k8s.LabelsForNginx(obj.Name)))
+		if err != nil {
+			logger.Error(err, "查询子资源: 失败", "kind", prunable.kind)
+			return err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			child, ok := item.(client.Object)
+			if !ok {
+				continue
+			}
+			// 只删除由当前 CRD 实例管理的资源
+			if desired[childKey(prunable.kind, child.GetName())] || !metaV1.IsControlledBy(child, obj) || child.GetDeletionTimestamp() != nil {
+				continue
+			}
+
+			logger.Info("删除不再需要的子资源", "kind", prunable.kind, "child", child.GetName())
+			if err := r.deleteChild(ctx, child); err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, "删除不再需要的子资源: 失败", "kind", prunable.kind, "child", child.GetName())
+				r.EventRecorder.Eventf(obj, coreV1.EventTypeWarning, "ChildPruneFailed", "删除不再需要的 %s %s 失败: %s", prunable.kind, child.GetName(), err)
+				return err
+			}
+			r.EventRecorder.Eventf(obj, coreV1.EventTypeNormal, "ChildPruned", "删除不再需要的 %s: %s", prunable.kind, child.GetName())
+		}
+	}
+	return nil
+}
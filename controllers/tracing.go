@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// TracerName 是 operator 创建 span 时使用的 instrumentation 名称
+const TracerName = "github.com/tomoncle/k8s-operator-nginx/controllers"
+
+// tracer 未设置 Tracer 时使用全局 TracerProvider, 未配置导出时为 noop
+func (r *NginxReconciler) tracer() trace.Tracer {
+	if r.Tracer != nil {
+		return r.Tracer
+	}
+	return otel.Tracer(TracerName)
+}
+
+// startSpan 为调谐 Nginx 实例的某个步骤创建 span
+func (r *NginxReconciler) startSpan(ctx context.Context, name string, obj *devopsV1.Nginx) (context.Context, trace.Span) {
+	return r.tracer().Start(ctx, name, trace.WithAttributes(
+		attribute.String("nginx.namespace", obj.Namespace),
+		attribute.String("nginx.name", obj.Name),
+	))
+}
+
+// endSpan 记录错误并结束 span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// NewTracingClient 包装 client.Client, 为每次 API 调用创建 span
+func NewTracingClient(c client.Client, tracer trace.Tracer) client.Client {
+	return &tracingClient{Client: c, tracer: tracer}
+}
+
+type tracingClient struct {
+	client.Client
+	tracer trace.Tracer
+}
+
+func (c *tracingClient) startSpan(ctx context.Context, verb string, obj client.Object, list client.ObjectList) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("k8s.verb", verb)}
+	if obj != nil {
+		if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+			attrs = append(attrs, attribute.String("k8s.kind", gvk.Kind))
+		}
+		attrs = append(attrs,
+			attribute.String("k8s.namespace", obj.GetNamespace()),
+			attribute.String("k8s.name", obj.GetName()),
+		)
+	}
+	if list != nil {
+		if gvk, err := apiutil.GVKForObject(list, c.Scheme()); err == nil {
+			attrs = append(attrs, attribute.String("k8s.kind", gvk.Kind))
+		}
+	}
+	return c.tracer.Start(ctx, "k8s."+verb, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func (c *tracingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) (err error) {
+	ctx, span := c.startSpan(ctx, "get", obj, nil)
+	span.SetAttributes(attribute.String("k8s.namespace", key.Namespace), attribute.String("k8s.name", key.Name))
+	defer func() { endSpan(span, err) }()
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func (c *tracingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) (err error) {
+	ctx, span := c.startSpan(ctx, "list", nil, list)
+	defer func() { endSpan(span, err) }()
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c *tracingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) (err error) {
+	ctx, span := c.startSpan(ctx, "create", obj, nil)
+	defer func() { endSpan(span, err) }()
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) (err error) {
+	ctx, span := c.startSpan(ctx, "delete", obj, nil)
+	defer func() { endSpan(span, err) }()
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) (err error) {
+	ctx, span := c.startSpan(ctx, "update", obj, nil)
+	defer func() { endSpan(span, err) }()
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) (err error) {
+	ctx, span := c.startSpan(ctx, "patch", obj, nil)
+	defer func() { endSpan(span, err) }()
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *tracingClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) (err error) {
+	ctx, span := c.startSpan(ctx, "deletecollection", obj, nil)
+	defer func() { endSpan(span, err) }()
+	return c.Client.DeleteAllOf(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Status() client.SubResourceWriter {
+	return &tracingStatusWriter{SubResourceWriter: c.Client.Status(), client: c}
+}
+
+type tracingStatusWriter struct {
+	client.SubResourceWriter
+	client *tracingClient
+}
+
+func (w *tracingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) (err error) {
+	ctx, span := w.client.startSpan(ctx, "update.status", obj, nil)
+	defer func() { endSpan(span, err) }()
+	return w.SubResourceWriter.Update(ctx, obj, opts...)
+}
+
+func (w *tracingStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) (err error) {
+	ctx, span := w.client.startSpan(ctx, "patch.status", obj, nil)
+	defer func() { endSpan(span, err) }()
+	return w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTracingTestReconciler(t *testing.T, objs ...*devopsV1.Nginx) (*NginxReconciler, *tracetest.InMemoryExporter) {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := devopsV1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for _, obj := range objs {
+		builder = builder.WithObjects(obj)
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	tracer := provider.Tracer(TracerName)
+
+	return &NginxReconciler{
+		Client:        NewTracingClient(builder.Build(), tracer),
+		EventRecorder: record.NewFakeRecorder(100),
+		Log:           logr.Discard(),
+		Scheme:        scheme,
+		Tracer:        tracer,
+	}, exporter
+}
+
+func newTracingTestNginx(config *devopsV1.ConfigRef) *devopsV1.Nginx {
+	return &devopsV1.Nginx{
+		ObjectMeta: metaV1.ObjectMeta{Name: "nginx-sample", Namespace: "default", UID: "nginx-sample-uid"},
+		Spec: devopsV1.NginxSpec{
+			Image:  "nginx:latest",
+			Config: config,
+		},
+	}
+}
+
+func spansByName(spans tracetest.SpanStubs) map[string][]tracetest.SpanStub {
+	byName := map[string][]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+	return byName
+}
+
+func TestReconcileSpans(t *testing.T) {
+	nginx := newTracingTestNginx(nil)
+	r, exporter := newTracingTestReconciler(t, nginx)
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: nginx.Name, Namespace: nginx.Namespace}}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+
+	byName := spansByName(exporter.GetSpans())
+	if len(byName["Reconcile"]) != 1 {
+		t.Fatalf("expected one Reconcile span, got %d", len(byName["Reconcile"]))
+	}
+	root := byName["Reconcile"][0]
+
+	for _, name := range []string{"reconcileDeployment", "reconcileService", "reconcileIngress", "refreshStatus"} {
+		spans := byName[name]
+		if len(spans) != 1 {
+			t.Errorf("expected one %s span, got %d", name, len(spans))
+			continue
+		}
+		if spans[0].Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Errorf("%s span is not a child of the Reconcile span", name)
+		}
+	}
+
+	for _, name := range []string{"k8s.get", "k8s.create", "k8s.list", "k8s.update.status"} {
+		if len(byName[name]) == 0 {
+			t.Errorf("expected at least one %s span", name)
+		}
+	}
+	for _, span := range byName["k8s.create"] {
+		if span.Parent.TraceID() != root.SpanContext.TraceID() {
+			t.Errorf("k8s.create span is not part of the Reconcile trace")
+		}
+	}
+}
+
+func TestReconcileSpanRecordsError(t *testing.T) {
+	nginx := newTracingTestNginx(&devopsV1.ConfigRef{Kind: devopsV1.ConfigKindInline})
+	r, exporter := newTracingTestReconciler(t, nginx)
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: nginx.Name, Namespace: nginx.Namespace}}
+	if _, err := r.Reconcile(context.Background(), req); err == nil {
+		t.Fatal("expected reconcile to fail on an invalid config")
+	}
+
+	spans := spansByName(exporter.GetSpans())["Reconcile"]
+	if len(spans) != 1 {
+		t.Fatalf("expected one Reconcile span, got %d", len(spans))
+	}
+	if spans[0].Status.Code != codes.Error {
+		t.Errorf("expected Reconcile span status to be Error, got %v", spans[0].Status.Code)
+	}
+	if len(spans[0].Events) == 0 {
+		t.Errorf("expected the error to be recorded on the Reconcile span")
+	}
+}
@@ -17,17 +17,32 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -48,28 +63,134 @@ func init() {
 	//+kubebuilder:scaffold:scheme
 }
 
+// setupTracing 配置 OTLP gRPC 导出的 TracerProvider, 未设置 endpoint 时不导出 span
+func setupTracing(ctx context.Context, endpoint string, insecure bool, samplingRatio float64) (trace.TracerProvider, func(context.Context) error, error) {
+	if endpoint == "" {
+		return trace.NewNoopTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(samplingRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("k8s-operator-nginx"),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider, provider.Shutdown, nil
+}
+
+// parseNamespaces 解析逗号分隔的命名空间列表, 忽略空白项
+func parseNamespaces(value string) []string {
+	var namespaces []string
+	for _, namespace := range strings.Split(value, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var otlpEndpoint string
+	var otlpInsecure bool
+	var traceSamplingRatio float64
+	var logFormat string
+	var annotationFilter string
+	var labelSelector string
+	var shardID int
+	var shardCount int
+	var watchNamespaces string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "The OTLP gRPC endpoint (host:port) traces are exported to. Tracing is disabled when empty.")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false, "Disable TLS when connecting to the OTLP endpoint.")
+	flag.Float64Var(&traceSamplingRatio, "trace-sampling-ratio", 1.0, "The fraction of reconciles to trace, between 0 and 1.")
+	flag.StringVar(&annotationFilter, "annotation-filter", "", "Only manage Nginx instances whose annotations match this selector, e.g. \"devops.github.com/class=internal\".")
+	flag.StringVar(&labelSelector, "label-selector", "", "Only manage Nginx instances whose labels match this selector.")
+	flag.IntVar(&shardID, "shard-id", 0, "The shard of Nginx instances managed by this operator, between 0 and --shard-count - 1.")
+	flag.IntVar(&shardCount, "shard-count", 1, "The number of shards Nginx instances are split into by hashing namespace/name.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "", "Comma separated namespaces the operator watches, e.g. \"a,b,c\". Watches all namespaces when empty.")
+	flag.StringVar(&logFormat, "log-format", "console", "The log output format, one of json|console.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
-	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	var encoder zap.Opts
+	switch logFormat {
+	case "json":
+		encoder = zap.JSONEncoder()
+	case "console":
+		encoder = zap.ConsoleEncoder()
+	default:
+		// logger 尚未初始化, 直接输出到标准错误
+		fmt.Fprintf(os.Stderr, "invalid --log-format %q, must be json or console\n", logFormat)
+		os.Exit(1)
+	}
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts), encoder))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	annotationSelector, err := labels.Parse(annotationFilter)
+	if err != nil {
+		setupLog.Error(err, "invalid --annotation-filter")
+		os.Exit(1)
+	}
+	nginxSelector, err := labels.Parse(labelSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid --label-selector")
+		os.Exit(1)
+	}
+	if shardCount < 1 || shardID < 0 || shardID >= shardCount {
+		setupLog.Error(fmt.Errorf("shard-id %d out of range for shard-count %d", shardID, shardCount), "invalid sharding flags")
+		os.Exit(1)
+	}
+	// 每个分片需要独立选主, 否则多个分片中只有一个副本在工作
+	leaderElectionID := "2bcd64da.github.com"
+	if shardCount > 1 {
+		leaderElectionID = fmt.Sprintf("shard-%d.%s", shardID, leaderElectionID)
+	}
+
+	namespaces := parseNamespaces(watchNamespaces)
+
+	tracerProvider, shutdownTracing, err := setupTracing(context.Background(), otlpEndpoint, otlpInsecure, traceSamplingRatio)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			setupLog.Error(err, "unable to flush traces")
+		}
+	}()
+	tracer := tracerProvider.Tracer(controllers.TracerName)
+
+	options := ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "2bcd64da.github.com",
+		LeaderElectionID:       leaderElectionID,
+		// Secret 和 ConfigMap 只以元数据的方式监听, 读取时不经过缓存, 避免缓存集群中所有 Secret 的内容
+		ClientDisableCacheFor: []client.Object{&corev1.Secret{}, &corev1.ConfigMap{}},
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -81,17 +202,38 @@ func main() {
 		// if you are doing or is intended to do any operation such as perform cleanups
 		// after the manager stops then its usage might be unsafe.
 		// LeaderElectionReleaseOnCancel: true,
-	})
+	}
+	// 只监听指定的命名空间, 配合 config/rbac-namespaced 中的 Role 使用, 不需要集群级别的权限
+	switch len(namespaces) {
+	case 0:
+	case 1:
+		options.Namespace = namespaces[0]
+	default:
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+	if len(namespaces) > 0 {
+		setupLog.Info("watching namespaces", "namespaces", namespaces)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
 	if err = (&controllers.NginxReconciler{
-		Client:        mgr.GetClient(),
+		Client:        controllers.NewTracingClient(mgr.GetClient(), tracer),
+		APIReader:     mgr.GetAPIReader(),
 		Log:           ctrl.Log.WithName("controllers").WithName("nginx"),
 		EventRecorder: mgr.GetEventRecorderFor("k8s-operator-nginx"),
 		Scheme:        mgr.GetScheme(),
+		Tracer:        tracer,
+
+		AnnotationFilter: annotationSelector,
+		LabelSelector:    nginxSelector,
+		ShardID:          shardID,
+		ShardCount:       shardCount,
+		WatchNamespaces:  namespaces,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Nginx")
 		os.Exit(1)
@@ -0,0 +1,291 @@
+package k8s
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	"github.com/tomoncle/k8s-operator-nginx/pkg/k8s/ingressprofile"
+	coreV1 "k8s.io/api/core/v1"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// BasicAuthFileKey 生成的 htpasswd 文件, 与 ingress-nginx auth-file 类型的 Secret 格式一致
+	BasicAuthFileKey = "auth"
+	// basicAuthTraefikKey Traefik basicAuth 中间件读取的键
+	basicAuthTraefikKey       = "users"
+	basicAuthHTPasswdKey      = "htpasswd"
+	basicAuthVolumeName       = "nginx-basic-auth"
+	basicAuthMountPath        = "/etc/nginx/operator-auth"
+	basicAuthVariable         = "$nginx_operator_basic_auth"
+	apr1Magic                 = "$apr1$"
+	apr1Alphabet              = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	apr1SaltLength            = 8
+	basicAuthUserInvalidChars = ":\r\n"
+)
+
+func IsBasicAuthEnabled(n *devopsV1.Nginx) bool {
+	return n.Spec.Auth != nil && n.Spec.Auth.Basic != nil
+}
+
+// isBasicAuthEnforcedByNginx 未指定 enforcedBy 时在 nginx 中认证
+func isBasicAuthEnforcedByNginx(n *devopsV1.Nginx) bool {
+	return IsBasicAuthEnabled(n) && n.Spec.Auth.Basic.EnforcedBy != devopsV1.EnforcementIngress
+}
+
+// GetBasicAuthSourceSecretName 返回保存用户的 Secret, 未开启认证时返回空
+func GetBasicAuthSourceSecretName(n *devopsV1.Nginx) string {
+	if !IsBasicAuthEnabled(n) {
+		return ""
+	}
+	return n.Spec.Auth.Basic.SecretName
+}
+
+// getHealthCheckPaths 返回 kubelet 检查使用的路径, 认证和限流需要绕过这些路径, 否则检查会失败
+func getHealthCheckPaths(n *devopsV1.Nginx) []string {
+	paths := map[string]bool{}
+	if n.Spec.HealthcheckPath != "" {
+		paths[n.Spec.HealthcheckPath] = true
+	}
+	probes := getProbes(n)
+	for _, probe := range []*devopsV1.NginxProbe{probes.Readiness, probes.Liveness, probes.Startup} {
+		if probe != nil && probe.Path != "" {
+			paths[probe.Path] = true
+		}
+	}
+
+	exempt := make([]string, 0, len(paths))
+	for path := range paths {
+		exempt = append(exempt, path)
+	}
+	sort.Strings(exempt)
+	return exempt
+}
+
+// quoteNginxString 转义 nginx 配置中双引号字符串的内容
+func quoteNginxString(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// getBasicAuthSnippet 通过 map 按 $uri 计算 auth_basic 的 realm, 不需要认证的路径取值为 off,
+// 在 http 块中生效, 无需修改用户的 server 配置
+func getBasicAuthSnippet(n *devopsV1.Nginx) string {
+	auth := n.Spec.Auth.Basic
+	realm := quoteNginxString(ingressprofile.BasicAuthRealm(auth))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "map $uri %s {\n", basicAuthVariable)
+	if len(auth.Paths) == 0 {
+		fmt.Fprintf(&b, "    default %s;\n", realm)
+	} else {
+		b.WriteString("    default off;\n")
+	}
+	// 精确匹配优先于正则匹配
+	for _, path := range getHealthCheckPaths(n) {
+		fmt.Fprintf(&b, "    %s off;\n", quoteNginxString(path))
+	}
+	for _, path := range auth.Paths {
+		fmt.Fprintf(&b, "    %s %s;\n", quoteNginxString("~^"+regexp.QuoteMeta(path)), realm)
+	}
+	b.WriteString("}\n")
+	fmt.Fprintf(&b, "auth_basic %s;\n", basicAuthVariable)
+	fmt.Fprintf(&b, "auth_basic_user_file %s/%s;\n", basicAuthMountPath, BasicAuthFileKey)
+	return b.String()
+}
+
+// setBasicAuth 挂载生成的 htpasswd Secret. nginx 每次认证都会读取该文件,
+// kubelet 同步 Secret 更新后立即生效, 因此不使用 subPath, 也不需要滚动更新
+func setBasicAuth(n *devopsV1.Nginx, template *coreV1.PodTemplateSpec) {
+	if !isBasicAuthEnforcedByNginx(n) {
+		return
+	}
+	container := &template.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, coreV1.VolumeMount{
+		Name: basicAuthVolumeName, MountPath: basicAuthMountPath, ReadOnly: true,
+	})
+	template.Spec.Volumes = append(template.Spec.Volumes, coreV1.Volume{
+		Name: basicAuthVolumeName,
+		VolumeSource: coreV1.VolumeSource{Secret: &coreV1.SecretVolumeSource{
+			SecretName: ingressprofile.BasicAuthSecretName(n),
+			Items:      []coreV1.KeyToPath{{Key: BasicAuthFileKey, Path: BasicAuthFileKey}},
+		}},
+	})
+}
+
+// apr1Salt 由 Secret UID 和用户名计算固定的盐值, 密码不变时生成的 htpasswd 保持不变, 避免每次调谐都更新 Secret
+func apr1Salt(uid, user string) string {
+	sum := sha256.Sum256([]byte(uid + "/" + user))
+	salt := make([]byte, apr1SaltLength)
+	for i := range salt {
+		salt[i] = apr1Alphabet[sum[i]&0x3f]
+	}
+	return string(salt)
+}
+
+// apr1Crypt Apache 的 MD5 密码哈希, nginx, ingress-nginx 和 Traefik 均支持
+func apr1Crypt(password, salt string) string {
+	pw, s := []byte(password), []byte(salt)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write(s)
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	ctx := md5.New()
+	ctx.Write(pw)
+	ctx.Write([]byte(apr1Magic))
+	ctx.Write(s)
+	for i := len(pw); i > 0; i -= 16 {
+		ctx.Write(altSum[:minInt(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	sum := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 == 1 {
+			round.Write(pw)
+		} else {
+			round.Write(sum)
+		}
+		if i%3 != 0 {
+			round.Write(s)
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 == 1 {
+			round.Write(sum)
+		} else {
+			round.Write(pw)
+		}
+		sum = round.Sum(nil)
+	}
+
+	var out bytes.Buffer
+	encode := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			out.WriteByte(apr1Alphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(sum[g[0]])<<16|uint32(sum[g[1]])<<8|uint32(sum[g[2]]), 4)
+	}
+	encode(uint32(sum[11]), 2)
+	return apr1Magic + salt + "$" + out.String()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// RenderHTPasswd 根据用户 Secret 生成 htpasswd 文件, Secret 中已有 htpasswd 文件时直接使用
+func RenderHTPasswd(source *coreV1.Secret) ([]byte, error) {
+	for _, key := range []string{BasicAuthFileKey, basicAuthHTPasswdKey} {
+		if htpasswd, ok := source.Data[key]; ok {
+			return htpasswd, nil
+		}
+	}
+	if len(source.Data) == 0 {
+		return nil, fmt.Errorf("secret %s has no users", source.Name)
+	}
+
+	users := make([]string, 0, len(source.Data))
+	for user := range source.Data {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	var htpasswd bytes.Buffer
+	for _, user := range users {
+		password := string(source.Data[user])
+		if strings.ContainsAny(user, basicAuthUserInvalidChars) {
+			return nil, fmt.Errorf("secret %s: invalid user name %q", source.Name, user)
+		}
+		if password == "" {
+			return nil, fmt.Errorf("secret %s: empty password for user %q", source.Name, user)
+		}
+		fmt.Fprintf(&htpasswd, "%s:%s\n", user, apr1Crypt(password, apr1Salt(string(source.UID), user)))
+	}
+	return htpasswd.Bytes(), nil
+}
+
+// NewBasicAuthSecret 根据用户 Secret 生成 htpasswd Secret, 同时提供 ingress-nginx 和 Traefik 需要的键
+func NewBasicAuthSecret(n *devopsV1.Nginx, source *coreV1.Secret) (*coreV1.Secret, error) {
+	htpasswd, err := RenderHTPasswd(source)
+	if err != nil {
+		return nil, err
+	}
+	return &coreV1.Secret{
+		TypeMeta:   GetTypeMeta(BasicAuthSecret),
+		ObjectMeta: GetObjectMeta(BasicAuthSecret, n, LabelsForNginx(n.Name), nil),
+		Type:       coreV1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			BasicAuthFileKey:    htpasswd,
+			basicAuthTraefikKey: htpasswd,
+		},
+	}, nil
+}
+
+// ValidateAuth 校验 spec.auth
+func ValidateAuth(n *devopsV1.Nginx) error {
+	if n.Spec.Auth == nil {
+		return nil
+	}
+	if basic := n.Spec.Auth.Basic; basic != nil {
+		if n.Spec.Auth.OIDC != nil {
+			return fmt.Errorf("spec.auth: basic and oidc are mutually exclusive")
+		}
+		if basic.SecretName == "" {
+			return fmt.Errorf("spec.auth.basic.secretName: required")
+		}
+		return validateEnforcement(n, "spec.auth.basic", ingressprofile.AuthBasic, basic.Paths, basic.EnforcedBy)
+	}
+	if oidc := n.Spec.Auth.OIDC; oidc != nil {
+		if oidc.IssuerURL == "" || oidc.ClientID == "" || oidc.ClientSecretName == "" {
+			return fmt.Errorf("spec.auth.oidc: issuerURL, clientID and clientSecretName are required")
+		}
+		return validateEnforcement(n, "spec.auth.oidc", ingressprofile.AuthOIDC, oidc.Paths, oidc.EnforcedBy)
+	}
+	return nil
+}
+
+func validateEnforcement(n *devopsV1.Nginx, field string, kind ingressprofile.AuthKind, paths []string, enforcedBy devopsV1.Enforcement) error {
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("%s.paths: %q must start with /", field, path)
+		}
+	}
+	if enforcedBy == devopsV1.EnforcementIngress {
+		if n.Spec.Ingress == nil {
+			return fmt.Errorf("%s.enforcedBy: Ingress requires spec.ingress", field)
+		}
+		if len(paths) > 0 {
+			return fmt.Errorf("%s.paths: only supported when enforced by Nginx", field)
+		}
+		// 不支持时 Ingress 会在未认证的情况下发布, 必须拒绝而不是只产生 warning 事件
+		if translator := getIngressProfile(n); translator == nil || !translator.SupportsAuth(kind) {
+			return fmt.Errorf("%s.enforcedBy: Ingress is not supported by ingress profile %q", field, n.Spec.Ingress.Profile)
+		}
+		return nil
+	}
+	if n.Spec.HealthcheckPath == "" {
+		return fmt.Errorf("spec.healthcheckPath: required when %s is enforced by Nginx, health checks bypass authentication", field)
+	}
+	return nil
+}
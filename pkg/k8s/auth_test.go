@@ -0,0 +1,97 @@
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAPR1Crypt(t *testing.T) {
+	// 期望值由 openssl passwd -apr1 -salt <salt> <password> 生成
+	tests := []struct {
+		password, salt, want string
+	}{
+		{"p@ssw0rd-long-enough-xyz", "saltsalt", "$apr1$saltsalt$Yth5kivfxLr88VelMlXu/0"},
+		{"x", "abc", "$apr1$abc$51YrpNiEtKAQp4coykJmu."},
+	}
+	for _, tt := range tests {
+		if got := apr1Crypt(tt.password, tt.salt); got != tt.want {
+			t.Errorf("apr1Crypt(%q, %q) = %q, want %q", tt.password, tt.salt, got, tt.want)
+		}
+	}
+}
+
+func TestRenderHTPasswd(t *testing.T) {
+	source := &coreV1.Secret{
+		ObjectMeta: metaV1.ObjectMeta{Name: "users", UID: "0d7b3c1e"},
+		Data:       map[string][]byte{"bob": []byte("secret"), "alice": []byte("secret")},
+	}
+	first, err := RenderHTPasswd(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := RenderHTPasswd(source)
+	if string(first) != string(second) {
+		t.Errorf("htpasswd is not stable across renders:\n%s\n%s", first, second)
+	}
+	want := "alice:" + apr1Crypt("secret", apr1Salt("0d7b3c1e", "alice")) + "\n" +
+		"bob:" + apr1Crypt("secret", apr1Salt("0d7b3c1e", "bob")) + "\n"
+	if string(first) != want {
+		t.Errorf("RenderHTPasswd() = %q, want %q", first, want)
+	}
+
+	htpasswd := []byte("carol:$apr1$abc$51YrpNiEtKAQp4coykJmu.\n")
+	got, err := RenderHTPasswd(&coreV1.Secret{Data: map[string][]byte{"htpasswd": htpasswd}})
+	if err != nil || string(got) != string(htpasswd) {
+		t.Errorf("RenderHTPasswd() with htpasswd key = %q, %v, want it unchanged", got, err)
+	}
+
+	if _, err := RenderHTPasswd(&coreV1.Secret{Data: map[string][]byte{"dave": nil}}); err == nil {
+		t.Error("RenderHTPasswd() with empty password: want error")
+	}
+}
+
+func TestValidateAuthIngressProfile(t *testing.T) {
+	basic := &devopsV1.NginxAuth{Basic: &devopsV1.NginxBasicAuth{SecretName: "users", EnforcedBy: devopsV1.EnforcementIngress}}
+	oidc := &devopsV1.NginxAuth{OIDC: &devopsV1.NginxOIDCAuth{
+		IssuerURL: "https://accounts.example.com", ClientID: "docs", ClientSecretName: "docs-oidc",
+		EnforcedBy: devopsV1.EnforcementIngress,
+	}}
+
+	tests := []struct {
+		name    string
+		auth    *devopsV1.NginxAuth
+		profile devopsV1.IngressProfile
+		wantErr string
+	}{
+		{name: "basic on default profile", auth: basic},
+		{name: "basic on traefik", auth: basic, profile: devopsV1.IngressProfileTraefik},
+		{name: "basic on haproxy", auth: basic, profile: devopsV1.IngressProfileHAProxy, wantErr: "spec.auth.basic.enforcedBy"},
+		{name: "basic on aws-alb", auth: basic, profile: devopsV1.IngressProfileAWSALB, wantErr: "spec.auth.basic.enforcedBy"},
+		{name: "oidc on ingress-nginx", auth: oidc, profile: devopsV1.IngressProfileIngressNginx},
+		{name: "oidc on traefik", auth: oidc, profile: devopsV1.IngressProfileTraefik, wantErr: "spec.auth.oidc.enforcedBy"},
+		{name: "oidc on haproxy", auth: oidc, profile: devopsV1.IngressProfileHAProxy, wantErr: "spec.auth.oidc.enforcedBy"},
+		{name: "oidc on aws-alb", auth: oidc, profile: devopsV1.IngressProfileAWSALB, wantErr: "spec.auth.oidc.enforcedBy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &devopsV1.Nginx{Spec: devopsV1.NginxSpec{
+				Auth:    tt.auth,
+				Ingress: &devopsV1.NginxIngress{Profile: tt.profile},
+			}}
+			err := ValidateAuth(n)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateAuth() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateAuth() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
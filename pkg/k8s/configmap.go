@@ -0,0 +1,113 @@
+package k8s
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"sort"
+	"strings"
+)
+
+const generatedConfigVolumeName = "nginx-generated-config"
+
+// GetGeneratedConfigData 返回 operator 生成的配置片段, 没有需要生成的配置时返回空
+func GetGeneratedConfigData(n *devopsV1.Nginx) map[string]string {
+	data := DefaultMap()
+	if snippets := GetHTTPSnippets(n); len(snippets) > 0 {
+		data[httpSnippetFileName] = strings.Join(snippets, "\n")
+	}
+	if snippets := GetServerSnippets(n); len(snippets) > 0 {
+		data[serverSnippetFileName] = strings.Join(snippets, "\n")
+	}
+	if IsWAFEnabled(n) {
+		data[wafConfigFileName] = getWAFConfig(n)
+	}
+	// WAF 镜像默认的 server 自带一套 ModSecurity 规则, 与生成的规则重复加载会导致规则 ID 冲突, 同样需要替换
+	if n.Spec.Config == nil && (data[serverSnippetFileName] != "" || IsWAFEnabled(n)) {
+		data[defaultServerFileName] = getDefaultServerConfig(n)
+	}
+	return data
+}
+
+func HasGeneratedConfig(n *devopsV1.Nginx) bool {
+	return len(GetGeneratedConfigData(n)) > 0
+}
+
+// getGeneratedConfigChecksum 配置片段变化后需要滚动更新 Pod, 让 nginx 加载新的配置
+func getGeneratedConfigChecksum(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, k := range keys {
+		hash.Write([]byte(k))
+		hash.Write([]byte(data[k]))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// setGeneratedConfig 将生成配置的 ConfigMap 以目录方式挂载到 nginx 容器中
+func setGeneratedConfig(n *devopsV1.Nginx, template *coreV1.PodTemplateSpec) {
+	data := GetGeneratedConfigData(n)
+	if len(data) == 0 {
+		return
+	}
+
+	if template.Annotations == nil {
+		template.Annotations = make(map[string]string)
+	}
+	template.Annotations[MakeKeyForNginx("generated-config-checksum")] = getGeneratedConfigChecksum(data)
+
+	volumeMounts := []coreV1.VolumeMount{
+		{
+			Name:      generatedConfigVolumeName,
+			MountPath: operatorConfigMountPath,
+			ReadOnly:  true,
+		},
+	}
+	if n.Spec.Config == nil {
+		// 未自定义配置时使用镜像默认的 nginx.conf, 其 http 块会 include conf.d 目录
+		if _, ok := data[httpSnippetFileName]; ok {
+			volumeMounts = append(volumeMounts, coreV1.VolumeMount{
+				Name:      generatedConfigVolumeName,
+				MountPath: "/etc/nginx/conf.d/operator-" + httpSnippetFileName,
+				SubPath:   httpSnippetFileName,
+				ReadOnly:  true,
+			})
+		}
+		if _, ok := data[defaultServerFileName]; ok {
+			volumeMounts = append(volumeMounts, coreV1.VolumeMount{
+				Name:      generatedConfigVolumeName,
+				MountPath: "/etc/nginx/conf.d/default.conf",
+				SubPath:   defaultServerFileName,
+				ReadOnly:  true,
+			})
+		}
+	}
+	template.Spec.Containers[0].VolumeMounts = append(template.Spec.Containers[0].VolumeMounts, volumeMounts...)
+
+	template.Spec.Volumes = append(template.Spec.Volumes,
+		coreV1.Volume{
+			Name: generatedConfigVolumeName,
+			VolumeSource: coreV1.VolumeSource{
+				ConfigMap: &coreV1.ConfigMapVolumeSource{
+					LocalObjectReference: coreV1.LocalObjectReference{
+						Name: GetObjectMeta(GeneratedConfig, n, nil, nil).Name,
+					},
+				},
+			},
+		})
+}
+
+// NewGeneratedConfigMap 构建保存 operator 生成配置片段的 ConfigMap
+func NewGeneratedConfigMap(n *devopsV1.Nginx) *coreV1.ConfigMap {
+	return &coreV1.ConfigMap{
+		TypeMeta:   GetTypeMeta(GeneratedConfig),
+		ObjectMeta: GetObjectMeta(GeneratedConfig, n, LabelsForNginx(n.Name), DefaultMap()),
+		Data:       GetGeneratedConfigData(n),
+	}
+}
@@ -0,0 +1,300 @@
+package k8s
+
+import (
+	"fmt"
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWebRoot             = "/usr/share/nginx/html"
+	defaultGitSyncImage        = "registry.k8s.io/git-sync/git-sync:v4.2.1"
+	defaultGitSyncPollInterval = 60 * time.Second
+	defaultArchiveImage        = "alpine:3.19"
+	defaultContentImagePath    = "/usr/share/nginx/html"
+	contentRoot                = "/content"
+	contentVolumeName          = "nginx-content"
+	contentGitAuthVolumeName   = "nginx-content-git-auth"
+	gitSyncRoot                = "/git"
+	gitSyncAuthMountPath       = "/etc/git-secret"
+	// gitSyncRepoLink 配置了 path 时 git-sync 维护的链接, web 根目录再链接到其中的子目录
+	gitSyncRepoLink = ".repo"
+
+	GitSyncInitContainerName    = "git-sync-init"
+	GitSyncSidecarContainerName = "git-sync"
+	contentLinkContainerName    = "content-link"
+	contentArchiveContainerName = "content-archive"
+	contentImageContainerName   = "content-image"
+)
+
+// contentArchiveScript 下载到 emptyDir 中校验后解压, 变量通过环境变量传入避免拼接 shell
+const contentArchiveScript = `set -e
+wget -qO "$CONTENT_ROOT/.archive" "$CONTENT_URL"
+echo "$CONTENT_SHA256  $CONTENT_ROOT/.archive" | sha256sum -c -
+mkdir -p "$CONTENT_DIR"
+tar -xf "$CONTENT_ROOT/.archive" -C "$CONTENT_DIR" --strip-components="$CONTENT_STRIP_COMPONENTS"
+rm -f "$CONTENT_ROOT/.archive"
+`
+
+func IsGitContentEnabled(n *devopsV1.Nginx) bool {
+	return n.Spec.Content != nil && n.Spec.Content.Git != nil
+}
+
+func getWebRoot(n *devopsV1.Nginx) string {
+	if n.Spec.Content == nil {
+		return defaultWebRoot
+	}
+	return path.Clean(NewDefaultStringUtils(n.Spec.Content.WebRoot, defaultWebRoot).ValueOrDefault())
+}
+
+// isSSHRepository ssh 仓库使用私钥认证, 其他仓库使用用户名和密码
+func isSSHRepository(repository string) bool {
+	return strings.HasPrefix(repository, "ssh://") || (!strings.Contains(repository, "://") && strings.Contains(repository, "@"))
+}
+
+// getGitSyncLink git-sync 在 emptyDir 中维护的符号链接, 每次同步后原子切换到新的 worktree
+func getGitSyncLink(n *devopsV1.Nginx) string {
+	if strings.Trim(n.Spec.Content.Git.Path, "/") != "" {
+		return gitSyncRepoLink
+	}
+	return path.Base(getWebRoot(n))
+}
+
+func getGitSyncArgs(n *devopsV1.Nginx, oneTime bool) []string {
+	git := n.Spec.Content.Git
+	period := defaultGitSyncPollInterval
+	if git.PollInterval != nil && git.PollInterval.Duration > 0 {
+		period = git.PollInterval.Duration
+	}
+	args := []string{
+		"--repo=" + git.Repository,
+		"--ref=" + NewDefaultStringUtils(git.Ref, "HEAD").ValueOrDefault(),
+		"--root=" + gitSyncRoot,
+		"--link=" + getGitSyncLink(n),
+		"--depth=1",
+	}
+	if oneTime {
+		args = append(args, "--one-time")
+	} else {
+		args = append(args, "--period="+period.String())
+	}
+	if git.AuthSecretName != "" {
+		if isSSHRepository(git.Repository) {
+			args = append(args,
+				"--ssh-key-file="+path.Join(gitSyncAuthMountPath, coreV1.SSHAuthPrivateKey),
+				"--ssh-known-hosts-file="+path.Join(gitSyncAuthMountPath, "known_hosts"))
+		} else {
+			args = append(args,
+				"--username=$(GITSYNC_USERNAME)",
+				"--password-file="+path.Join(gitSyncAuthMountPath, coreV1.BasicAuthPasswordKey))
+		}
+	}
+	return args
+}
+
+func newGitSyncContainer(n *devopsV1.Nginx, name string, oneTime bool) coreV1.Container {
+	git := n.Spec.Content.Git
+	container := coreV1.Container{
+		Name:         name,
+		Image:        NewDefaultStringUtils(git.Image, defaultGitSyncImage).ValueOrDefault(),
+		Args:         getGitSyncArgs(n, oneTime),
+		Resources:    git.Resources,
+		VolumeMounts: []coreV1.VolumeMount{{Name: contentVolumeName, MountPath: gitSyncRoot}},
+	}
+	if oneTime {
+		// 首次同步完成后把 commit 写入 termination message, 由 operator 汇总到 status.content
+		container.Command = []string{"/bin/sh", "-c",
+			fmt.Sprintf(`/git-sync "$@" && git -C %s rev-parse HEAD > %s`,
+				path.Join(gitSyncRoot, getGitSyncLink(n)), coreV1.TerminationMessagePathDefault), "--"}
+		container.TerminationMessagePath = coreV1.TerminationMessagePathDefault
+		container.TerminationMessagePolicy = coreV1.TerminationMessageReadFile
+	}
+	if git.AuthSecretName != "" {
+		container.VolumeMounts = append(container.VolumeMounts, coreV1.VolumeMount{
+			Name: contentGitAuthVolumeName, MountPath: gitSyncAuthMountPath, ReadOnly: true,
+		})
+		if !isSSHRepository(git.Repository) {
+			container.Env = []coreV1.EnvVar{{
+				Name: "GITSYNC_USERNAME",
+				ValueFrom: &coreV1.EnvVarSource{SecretKeyRef: &coreV1.SecretKeySelector{
+					LocalObjectReference: coreV1.LocalObjectReference{Name: git.AuthSecretName},
+					Key:                  coreV1.BasicAuthUsernameKey,
+				}},
+			}}
+		}
+	}
+	if IsUnprivileged(n) {
+		// git 需要写 $HOME 等临时文件, 不使用只读根文件系统
+		container.SecurityContext = getRestrictedSecurityContext(&coreV1.SecurityContext{
+			ReadOnlyRootFilesystem: func(b bool) *bool { return &b }(false),
+		})
+	}
+	return container
+}
+
+// newContentLinkContainer 配置了 path 时, 把 web 根目录链接到仓库子目录.
+// 相对链接指向 git-sync 维护的链接, 后续同步切换 worktree 后依然有效
+func newContentLinkContainer(n *devopsV1.Nginx) coreV1.Container {
+	target := path.Join(gitSyncRepoLink, strings.Trim(path.Clean("/"+n.Spec.Content.Git.Path), "/"))
+	container := coreV1.Container{
+		Name:         contentLinkContainerName,
+		Image:        getImage(n),
+		Command:      []string{"ln", "-sfn", target, path.Join(gitSyncRoot, path.Base(getWebRoot(n)))},
+		VolumeMounts: []coreV1.VolumeMount{{Name: contentVolumeName, MountPath: gitSyncRoot}},
+	}
+	if IsUnprivileged(n) {
+		container.SecurityContext = getRestrictedSecurityContext(nil)
+	}
+	return container
+}
+
+// getContentSource 内容来源的版本标识, 写入 Pod 模板注解
+func getContentSource(n *devopsV1.Nginx) string {
+	content := n.Spec.Content
+	switch {
+	case content.Archive != nil:
+		return "sha256:" + content.Archive.SHA256
+	case content.Image != nil:
+		return content.Image.Reference
+	default:
+		return ""
+	}
+}
+
+// getContentInitSecurityContext 非 root 模式下, 内容镜像和下载镜像通常以 root 运行, 改为 nginx 用户
+func getContentInitSecurityContext(n *devopsV1.Nginx) *coreV1.SecurityContext {
+	if !IsUnprivileged(n) {
+		return nil
+	}
+	return getRestrictedSecurityContext(&coreV1.SecurityContext{
+		RunAsUser: func(i int64) *int64 { return &i }(101),
+	})
+}
+
+func newContentArchiveContainer(n *devopsV1.Nginx) coreV1.Container {
+	archive := n.Spec.Content.Archive
+	return coreV1.Container{
+		Name:    contentArchiveContainerName,
+		Image:   NewDefaultStringUtils(archive.DownloaderImage, defaultArchiveImage).ValueOrDefault(),
+		Command: []string{"/bin/sh", "-c", contentArchiveScript},
+		Env: []coreV1.EnvVar{
+			{Name: "CONTENT_ROOT", Value: contentRoot},
+			{Name: "CONTENT_DIR", Value: path.Join(contentRoot, path.Base(getWebRoot(n)))},
+			{Name: "CONTENT_URL", Value: archive.URL},
+			{Name: "CONTENT_SHA256", Value: archive.SHA256},
+			{Name: "CONTENT_STRIP_COMPONENTS", Value: fmt.Sprint(archive.StripComponents)},
+		},
+		SecurityContext: getContentInitSecurityContext(n),
+		VolumeMounts:    []coreV1.VolumeMount{{Name: contentVolumeName, MountPath: contentRoot}},
+	}
+}
+
+func newContentImageContainer(n *devopsV1.Nginx) coreV1.Container {
+	image := n.Spec.Content.Image
+	source := path.Clean(NewDefaultStringUtils(image.Path, defaultContentImagePath).ValueOrDefault())
+	return coreV1.Container{
+		Name:            contentImageContainerName,
+		Image:           image.Reference,
+		ImagePullPolicy: image.ImagePullPolicy,
+		Command:         []string{"cp", "-R", source + "/.", path.Join(contentRoot, path.Base(getWebRoot(n)))},
+		SecurityContext: getContentInitSecurityContext(n),
+		VolumeMounts:    []coreV1.VolumeMount{{Name: contentVolumeName, MountPath: contentRoot}},
+	}
+}
+
+// setContent 在 nginx 启动前由 init 容器准备 web 根目录.
+// emptyDir 挂载在 web 根目录的父目录, 避免覆盖镜像中的其他文件
+func setContent(n *devopsV1.Nginx, template *coreV1.PodTemplateSpec) {
+	content := n.Spec.Content
+	if content == nil || (content.Git == nil && content.Archive == nil && content.Image == nil) {
+		return
+	}
+
+	container := &template.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, coreV1.VolumeMount{
+		Name: contentVolumeName, MountPath: path.Dir(getWebRoot(n)), ReadOnly: true,
+	})
+	template.Spec.Volumes = append(template.Spec.Volumes, coreV1.Volume{
+		Name:         contentVolumeName,
+		VolumeSource: coreV1.VolumeSource{EmptyDir: &coreV1.EmptyDirVolumeSource{}},
+	})
+
+	switch {
+	case content.Git != nil:
+		setContentGit(n, template)
+	case content.Archive != nil:
+		template.Spec.InitContainers = append([]coreV1.Container{newContentArchiveContainer(n)}, template.Spec.InitContainers...)
+	case content.Image != nil:
+		template.Spec.InitContainers = append([]coreV1.Container{newContentImageContainer(n)}, template.Spec.InitContainers...)
+	}
+
+	// 来源变化时 init 容器参数随之变化, 注解便于查看当前 Pod 使用的版本
+	if source := getContentSource(n); source != "" {
+		if template.Annotations == nil {
+			template.Annotations = make(map[string]string)
+		}
+		template.Annotations[MakeKeyForNginx("content-source")] = source
+	}
+}
+
+// setContentGit git-sync init 容器完成首次同步后 nginx 才启动, sidecar 容器持续同步.
+// web 根目录是指向当前内容的符号链接, 每次同步后原子切换
+func setContentGit(n *devopsV1.Nginx, template *coreV1.PodTemplateSpec) {
+	initContainers := []coreV1.Container{newGitSyncContainer(n, GitSyncInitContainerName, true)}
+	if getGitSyncLink(n) == gitSyncRepoLink {
+		initContainers = append(initContainers, newContentLinkContainer(n))
+	}
+	template.Spec.InitContainers = append(initContainers, template.Spec.InitContainers...)
+	template.Spec.Containers = append(template.Spec.Containers, newGitSyncContainer(n, GitSyncSidecarContainerName, false))
+
+	if secretName := n.Spec.Content.Git.AuthSecretName; secretName != "" {
+		template.Spec.Volumes = append(template.Spec.Volumes, coreV1.Volume{
+			Name: contentGitAuthVolumeName,
+			VolumeSource: coreV1.VolumeSource{Secret: &coreV1.SecretVolumeSource{
+				SecretName:  secretName,
+				DefaultMode: func(i int32) *int32 { return &i }(0400),
+			}},
+		})
+	}
+}
+
+// ValidateContent 校验 spec.content, web 根目录的父目录会被 emptyDir 覆盖, 不能是根目录
+func ValidateContent(n *devopsV1.Nginx) error {
+	if n.Spec.Content == nil {
+		return nil
+	}
+	if webRoot := n.Spec.Content.WebRoot; webRoot != "" {
+		if !path.IsAbs(webRoot) || path.Dir(path.Clean(webRoot)) == "/" {
+			return fmt.Errorf("spec.content.webRoot: %q must be an absolute path at least two levels deep", webRoot)
+		}
+	}
+	sources := 0
+	for _, set := range []bool{n.Spec.Content.Git != nil, n.Spec.Content.Archive != nil, n.Spec.Content.Image != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("spec.content: git, archive and image are mutually exclusive")
+	}
+	if image := n.Spec.Content.Image; image != nil {
+		if image.Reference == "" {
+			return fmt.Errorf("spec.content.image.reference: required")
+		}
+		if image.Path != "" && !path.IsAbs(image.Path) {
+			return fmt.Errorf("spec.content.image.path: %q must be an absolute path", image.Path)
+		}
+	}
+	if git := n.Spec.Content.Git; git != nil {
+		if git.Repository == "" {
+			return fmt.Errorf("spec.content.git.repository: required")
+		}
+		if path.IsAbs(git.Path) || strings.Contains(git.Path, "..") {
+			return fmt.Errorf("spec.content.git.path: %q must be a relative path inside the repository", git.Path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package k8s
+
+import (
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	appsV1 "k8s.io/api/apps/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func getDaemonSetUpdateStrategy(n *devopsV1.Nginx) appsV1.DaemonSetUpdateStrategy {
+	var maxSurge, maxUnavailable *intstr.IntOrString
+	if ru := n.Spec.PodTemplate.RollingUpdate; ru != nil {
+		maxSurge, maxUnavailable = ru.MaxSurge, ru.MaxUnavailable
+	}
+	if n.Spec.PodTemplate.HostNetwork {
+		// hostNetwork 模式下同一节点上新旧 Pod 会端口冲突，只能先删后建
+		maxSurge = nil
+	}
+	return appsV1.DaemonSetUpdateStrategy{
+		Type: appsV1.RollingUpdateDaemonSetStrategyType,
+		RollingUpdate: &appsV1.RollingUpdateDaemonSet{
+			MaxUnavailable: maxUnavailable,
+			MaxSurge:       maxSurge,
+		},
+	}
+}
+
+func NewDaemonSet(n *devopsV1.Nginx) (*appsV1.DaemonSet, error) {
+	daemonSet := appsV1.DaemonSet{
+		TypeMeta:   GetTypeMeta(DaemonSet),
+		ObjectMeta: GetObjectMeta(DaemonSet, n, LabelsForNginx(n.Name), getWorkloadAnnotations(n.Spec)),
+		Spec: appsV1.DaemonSetSpec{
+			UpdateStrategy:  getDaemonSetUpdateStrategy(n),
+			MinReadySeconds: getMinReadySeconds(n),
+			Selector:        &metaV1.LabelSelector{MatchLabels: LabelsForNginx(n.Name)},
+			Template:        newPodTemplateSpec(n),
+		},
+	}
+	return &daemonSet, nil
+}
@@ -23,6 +23,8 @@ const (
 	curlProbeCommand            = "curl -m%d -kfsS -o /dev/null %s"
 	configMountPath             = "/etc/nginx"
 	configFileName              = "nginx.conf"
+	cacheVolumeName             = "nginx-cache"
+	defaultCacheMountPath       = "/var/cache/nginx"
 )
 
 func findContainerPort(podSpec *devopsV1.PodTemplateSpec, name string) *coreV1.ContainerPort {
@@ -49,6 +51,9 @@ func getContainerPorts(n *devopsV1.Nginx) []coreV1.ContainerPort {
 		if podSpec.HostNetwork {
 			httpPort = defaultHTTPHostNetworkPort
 		}
+		if podSpec.Unprivileged {
+			httpPort = defaultUnprivilegedHTTPPort
+		}
 		podSpec.Ports = append(podSpec.Ports, makeContainerPort(defaultHTTPPortName, httpPort))
 	}
 	if findContainerPort(podSpec, defaultHTTPSPortName) == nil {
@@ -56,6 +61,9 @@ func getContainerPorts(n *devopsV1.Nginx) []coreV1.ContainerPort {
 		if podSpec.HostNetwork {
 			httpsPort = defaultHTTPSHostNetworkPort
 		}
+		if podSpec.Unprivileged {
+			httpsPort = defaultUnprivilegedHTTPSPort
+		}
 		podSpec.Ports = append(podSpec.Ports, makeContainerPort(defaultHTTPSPortName, httpsPort))
 	}
 	return podSpec.Ports
@@ -70,7 +78,7 @@ func hasLowPort(ports []coreV1.ContainerPort) bool {
 	return false
 }
 
-func getDeploymentAnnotations(spec devopsV1.NginxSpec) map[string]string {
+func getWorkloadAnnotations(spec devopsV1.NginxSpec) map[string]string {
 	origSpec, err := json.Marshal(spec)
 	if err != nil {
 		return DefaultMap()
@@ -78,14 +86,15 @@ func getDeploymentAnnotations(spec devopsV1.NginxSpec) map[string]string {
 	return map[string]string{MakeKeyForNginx("generated-from"): string(origSpec)}
 }
 
-func setConfigRef(conf *devopsV1.ConfigRef, deploy *appsV1.Deployment) {
+func setConfigRef(n *devopsV1.Nginx, template *coreV1.PodTemplateSpec) {
+	conf := n.Spec.Config
 	if conf == nil {
 		return
 	}
 	volumeName := "nginx-config"
 
-	containerVolumeMounts := deploy.Spec.Template.Spec.Containers[0].VolumeMounts
-	deploy.Spec.Template.Spec.Containers[0].VolumeMounts = append(
+	containerVolumeMounts := template.Spec.Containers[0].VolumeMounts
+	template.Spec.Containers[0].VolumeMounts = append(
 		containerVolumeMounts,
 		coreV1.VolumeMount{
 			Name:      volumeName,
@@ -94,10 +103,10 @@ func setConfigRef(conf *devopsV1.ConfigRef, deploy *appsV1.Deployment) {
 			ReadOnly:  true,
 		})
 
-	deploymentVolumes := deploy.Spec.Template.Spec.Volumes
+	templateVolumes := template.Spec.Volumes
 	switch conf.Kind {
-	case devopsV1.ConfigKindConfigMap:
-		deploy.Spec.Template.Spec.Volumes = append(deploymentVolumes,
+	case devopsV1.ConfigKindConfigMap, "":
+		template.Spec.Volumes = append(templateVolumes,
 			coreV1.Volume{
 				Name: volumeName,
 				VolumeSource: coreV1.VolumeSource{
@@ -110,14 +119,14 @@ func setConfigRef(conf *devopsV1.ConfigRef, deploy *appsV1.Deployment) {
 				},
 			})
 	case devopsV1.ConfigKindInline:
-		if deploy.Spec.Template.Annotations == nil {
-			deploy.Spec.Template.Annotations = make(map[string]string)
+		if template.Annotations == nil {
+			template.Annotations = make(map[string]string)
 		}
 
 		key := MakeKeyForNginx("custom-nginx-config")
-		deploy.Spec.Template.Annotations[key] = conf.Value
+		template.Annotations[key] = RenderInlineConfig(n)
 
-		deploy.Spec.Template.Spec.Volumes = append(deploymentVolumes,
+		template.Spec.Volumes = append(templateVolumes,
 			coreV1.Volume{
 				Name: volumeName,
 				VolumeSource: coreV1.VolumeSource{
@@ -136,58 +145,233 @@ func setConfigRef(conf *devopsV1.ConfigRef, deploy *appsV1.Deployment) {
 	}
 }
 
-// 健康检查1
-func getContainerProbes(n *devopsV1.Nginx) *coreV1.Probe {
-	httpPort := findContainerPort(&n.Spec.PodTemplate, defaultHTTPPortName)
-	//  没有找到端口，不配置
-	if httpPort == nil {
-		return nil
+func getCacheMountPath(n *devopsV1.Nginx) string {
+	if n.Spec.Cache == nil {
+		return ""
 	}
-	return &coreV1.Probe{
-		TimeoutSeconds:      int32(1), // 超时时间
-		InitialDelaySeconds: int32(5), // 延迟5秒触发
-		ProbeHandler: coreV1.ProbeHandler{
-			HTTPGet: &coreV1.HTTPGetAction{
-				Path: n.Spec.HealthcheckPath,
-				Port: intstr.FromInt(int(httpPort.ContainerPort)),
+	return NewDefaultStringUtils(n.Spec.Cache.Path, defaultCacheMountPath).ValueOrDefault()
+}
+
+// setCacheVolume 挂载缓存卷, StatefulSet 模式下卷来自 VolumeClaimTemplates, 其他模式使用 emptyDir
+func setCacheVolume(n *devopsV1.Nginx, template *coreV1.PodTemplateSpec) {
+	if n.Spec.Cache == nil {
+		return
+	}
+
+	template.Spec.Containers[0].VolumeMounts = append(template.Spec.Containers[0].VolumeMounts,
+		coreV1.VolumeMount{
+			Name:      cacheVolumeName,
+			MountPath: getCacheMountPath(n),
+		})
+
+	if GetWorkloadKind(n) == devopsV1.WorkloadKindStatefulSet {
+		return
+	}
+	template.Spec.Volumes = append(template.Spec.Volumes,
+		coreV1.Volume{
+			Name: cacheVolumeName,
+			VolumeSource: coreV1.VolumeSource{
+				EmptyDir: &coreV1.EmptyDirVolumeSource{},
 			},
+		})
+}
+
+const (
+	defaultDrainSeconds       = int32(5)
+	defaultQuitTimeoutSeconds = int32(30)
+	defaultMinReadySeconds    = int32(10)
+	// 预留给 kubelet 发送 SIGKILL 之前的缓冲时间
+	gracefulShutdownBufferSeconds = int64(5)
+)
+
+func IsGracefulShutdownEnabled(n *devopsV1.Nginx) bool {
+	return n.Spec.PodTemplate.GracefulShutdown != nil && n.Spec.PodTemplate.GracefulShutdown.Enabled
+}
+
+func int32OrDefault(value *int32, defaultValue int32) int32 {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
+
+// getMinReadySeconds 开启优雅退出时, 新 Pod 就绪后稳定一段时间再替换旧 Pod
+func getMinReadySeconds(n *devopsV1.Nginx) int32 {
+	if !IsGracefulShutdownEnabled(n) {
+		return 0
+	}
+	return int32OrDefault(n.Spec.PodTemplate.GracefulShutdown.MinReadySeconds, defaultMinReadySeconds)
+}
+
+// setGracefulShutdown 注入 preStop 钩子: 先等待 endpoint 摘除, 再让 nginx 处理完已有连接后退出.
+// nginx 收到 SIGTERM 会立即退出, 所以钩子需要持续到 nginx 主进程退出(容器随之停止),
+// TerminationGracePeriodSeconds 至少覆盖整个钩子的时间
+func setGracefulShutdown(n *devopsV1.Nginx, template *coreV1.PodTemplateSpec) {
+	if !IsGracefulShutdownEnabled(n) {
+		return
+	}
+	shutdown := n.Spec.PodTemplate.GracefulShutdown
+	drainSeconds := int32OrDefault(shutdown.DrainSeconds, defaultDrainSeconds)
+	quitTimeoutSeconds := int32OrDefault(shutdown.QuitTimeoutSeconds, defaultQuitTimeoutSeconds)
+
+	container := &template.Spec.Containers[0]
+	lifecycle := &coreV1.Lifecycle{}
+	if container.Lifecycle != nil {
+		lifecycle = container.Lifecycle.DeepCopy()
+	}
+	lifecycle.PreStop = &coreV1.LifecycleHandler{
+		Exec: &coreV1.ExecAction{
+			Command: []string{"/bin/sh", "-c",
+				fmt.Sprintf("sleep %d && nginx -s quit && sleep %d", drainSeconds, quitTimeoutSeconds)},
 		},
 	}
+	container.Lifecycle = lifecycle
+
+	gracePeriod := int64(drainSeconds) + int64(quitTimeoutSeconds) + gracefulShutdownBufferSeconds
+	if current := template.Spec.TerminationGracePeriodSeconds; current == nil || *current < gracePeriod {
+		template.Spec.TerminationGracePeriodSeconds = &gracePeriod
+	}
 }
 
-// 健康检查2
-func _(spec devopsV1.NginxSpec, dep *appsV1.Deployment) {
-	httpPort := findContainerPort(&spec.PodTemplate, defaultHTTPPortName)
-	cmdTimeoutSec := int32(1)
+// probeDefaults 健康检查未设置字段时使用的默认值
+type probeDefaults struct {
+	probeType           devopsV1.ProbeType
+	initialDelaySeconds int32
+	timeoutSeconds      int32
+	periodSeconds       int32
+	failureThreshold    int32
+}
+
+var (
+	readinessProbeDefaults = probeDefaults{devopsV1.ProbeTypeHTTP, 5, 1, 10, 3}
+	livenessProbeDefaults  = probeDefaults{devopsV1.ProbeTypeTCP, 10, 1, 10, 3}
+	// 启动检查最多等待 failureThreshold * periodSeconds = 60 秒
+	startupProbeDefaults = probeDefaults{devopsV1.ProbeTypeHTTP, 0, 1, 2, 30}
+)
+
+func getProbes(n *devopsV1.Nginx) devopsV1.NginxProbes {
+	if n.Spec.Probes == nil {
+		return devopsV1.NginxProbes{}
+	}
+	return *n.Spec.Probes
+}
+
+// getProbePort 返回检查使用的端口, 默认使用 http 端口, https 检查使用 https 端口
+func getProbePort(n *devopsV1.Nginx, probe devopsV1.NginxProbe, probeType devopsV1.ProbeType) (intstr.IntOrString, bool) {
+	if probe.Port != nil {
+		return *probe.Port, true
+	}
+	portName := defaultHTTPPortName
+	if probeType == devopsV1.ProbeTypeHTTPS {
+		portName = defaultHTTPSPortName
+	}
+	port := findContainerPort(&n.Spec.PodTemplate, portName)
+	if port == nil {
+		return intstr.IntOrString{}, false
+	}
+	return intstr.FromInt(int(port.ContainerPort)), true
+}
+
+// getCurlProbeCommands 使用 curl 检查 http 端口, 配置了 TLS 时同时检查 https 端口, 适用于在 Pod 中终止 TLS 的实例
+func getCurlProbeCommands(n *devopsV1.Nginx, path string, timeoutSeconds int32) []string {
 	var commands []string
-	if httpPort != nil {
-		httpURL := fmt.Sprintf("http://localhost:%d%s", httpPort.ContainerPort, spec.HealthcheckPath)
-		commands = append(commands, fmt.Sprintf(curlProbeCommand, cmdTimeoutSec, httpURL))
-	}
-	if len(spec.TLS) > 0 {
-		httpsPort := findContainerPort(&spec.PodTemplate, defaultHTTPSPortName)
-		if httpsPort != nil {
-			httpsURL := fmt.Sprintf("https://localhost:%d%s", httpsPort.ContainerPort, spec.HealthcheckPath)
-			commands = append(commands, fmt.Sprintf(curlProbeCommand, cmdTimeoutSec, httpsURL))
+	if httpPort := findContainerPort(&n.Spec.PodTemplate, defaultHTTPPortName); httpPort != nil {
+		httpURL := fmt.Sprintf("http://localhost:%d%s", httpPort.ContainerPort, path)
+		commands = append(commands, fmt.Sprintf(curlProbeCommand, timeoutSeconds, httpURL))
+	}
+	if len(n.Spec.TLS) > 0 {
+		if httpsPort := findContainerPort(&n.Spec.PodTemplate, defaultHTTPSPortName); httpsPort != nil {
+			httpsURL := fmt.Sprintf("https://localhost:%d%s", httpsPort.ContainerPort, path)
+			commands = append(commands, fmt.Sprintf(curlProbeCommand, timeoutSeconds, httpsURL))
 		}
 	}
-	if len(commands) == 0 {
-		return
+	return commands
+}
+
+// getContainerProbe 根据配置和默认值构建健康检查, 找不到检查端口时不配置
+func getContainerProbe(n *devopsV1.Nginx, probe devopsV1.NginxProbe, defaults probeDefaults) *coreV1.Probe {
+	probeType := probe.Type
+	if probeType == "" {
+		probeType = defaults.probeType
 	}
-	dep.Spec.Template.Spec.Containers[0].ReadinessProbe = &coreV1.Probe{
-		TimeoutSeconds:      cmdTimeoutSec * int32(len(commands)),
-		InitialDelaySeconds: int32(5), // 延迟5秒触发
-		ProbeHandler: coreV1.ProbeHandler{
-			Exec: &coreV1.ExecAction{
-				Command: []string{"sh", "-c", strings.Join(commands, " && ")},
-			},
-		},
+	path := NewDefaultStringUtils(probe.Path, n.Spec.HealthcheckPath).ValueOrDefault()
+	timeoutSeconds := int32OrDefault(probe.TimeoutSeconds, defaults.timeoutSeconds)
+
+	var handler coreV1.ProbeHandler
+	switch probeType {
+	case devopsV1.ProbeTypeExec:
+		command := probe.Command
+		if len(command) == 0 {
+			commands := getCurlProbeCommands(n, path, timeoutSeconds)
+			if len(commands) == 0 {
+				return nil
+			}
+			command = []string{"sh", "-c", strings.Join(commands, " && ")}
+			// 依次执行多个 curl, 总超时时间为每个命令超时时间之和
+			if probe.TimeoutSeconds == nil {
+				timeoutSeconds *= int32(len(commands))
+			}
+		}
+		handler.Exec = &coreV1.ExecAction{Command: command}
+	case devopsV1.ProbeTypeTCP:
+		port, ok := getProbePort(n, probe, probeType)
+		if !ok {
+			return nil
+		}
+		handler.TCPSocket = &coreV1.TCPSocketAction{Port: port}
+	default:
+		port, ok := getProbePort(n, probe, probeType)
+		if !ok {
+			return nil
+		}
+		scheme := coreV1.URISchemeHTTP
+		if probeType == devopsV1.ProbeTypeHTTPS {
+			scheme = coreV1.URISchemeHTTPS
+		}
+		handler.HTTPGet = &coreV1.HTTPGetAction{Path: path, Port: port, Scheme: scheme}
+	}
+
+	return &coreV1.Probe{
+		ProbeHandler:        handler,
+		InitialDelaySeconds: int32OrDefault(probe.InitialDelaySeconds, defaults.initialDelaySeconds),
+		TimeoutSeconds:      timeoutSeconds,
+		PeriodSeconds:       int32OrDefault(probe.PeriodSeconds, defaults.periodSeconds),
+		SuccessThreshold:    int32OrDefault(probe.SuccessThreshold, 1),
+		FailureThreshold:    int32OrDefault(probe.FailureThreshold, defaults.failureThreshold),
+	}
+}
+
+// getReadinessProbe 未配置时使用 http 检查 HealthcheckPath
+func getReadinessProbe(n *devopsV1.Nginx) *coreV1.Probe {
+	probe := getProbes(n).Readiness
+	if probe == nil {
+		probe = &devopsV1.NginxProbe{}
+	}
+	return getContainerProbe(n, *probe, readinessProbeDefaults)
+}
+
+func getLivenessProbe(n *devopsV1.Nginx) *coreV1.Probe {
+	probe := getProbes(n).Liveness
+	if probe == nil {
+		return nil
 	}
+	return getContainerProbe(n, *probe, livenessProbeDefaults)
+}
 
+func getStartupProbe(n *devopsV1.Nginx) *coreV1.Probe {
+	probe := getProbes(n).Startup
+	if probe == nil {
+		return nil
+	}
+	return getContainerProbe(n, *probe, startupProbeDefaults)
 }
 
 func getSecurityContext(n *devopsV1.Nginx) *coreV1.SecurityContext {
 	securityContext := n.Spec.PodTemplate.SecurityContext
+	// 非 root 模式使用非特权端口, 不需要 NET_BIND_SERVICE
+	if IsUnprivileged(n) {
+		return getRestrictedSecurityContext(securityContext)
+	}
 	if hasLowPort(n.Spec.PodTemplate.Ports) {
 		if securityContext == nil {
 			securityContext = &coreV1.SecurityContext{}
@@ -225,46 +409,96 @@ func getDeploymentStrategy(n *devopsV1.Nginx) appsV1.DeploymentStrategy {
 	}
 }
 
+// 开启自动扩缩容时副本数交由 HPA 管理, 不再设置 Spec.Replicas
+func getWorkloadReplicas(n *devopsV1.Nginx) *int32 {
+	if IsAutoscalingEnabled(n) {
+		return nil
+	}
+	return n.Spec.Replicas
+}
+
+// getTopologySpreadConstraints 未设置 labelSelector 的约束默认选择 nginx Pod
+func getTopologySpreadConstraints(n *devopsV1.Nginx) []coreV1.TopologySpreadConstraint {
+	var constraints []coreV1.TopologySpreadConstraint
+	for _, constraint := range n.Spec.PodTemplate.TopologySpreadConstraints {
+		constraint := *constraint.DeepCopy()
+		if constraint.LabelSelector == nil {
+			constraint.LabelSelector = &metaV1.LabelSelector{MatchLabels: LabelsForNginx(n.Name)}
+		}
+		constraints = append(constraints, constraint)
+	}
+	return constraints
+}
+
+// newPodTemplateSpec 构建 nginx Pod 模板, 各类工作负载共用
+func newPodTemplateSpec(n *devopsV1.Nginx) coreV1.PodTemplateSpec {
+	template := coreV1.PodTemplateSpec{
+		ObjectMeta: metaV1.ObjectMeta{
+			Namespace:   n.Namespace,
+			Annotations: n.Spec.PodTemplate.Annotations,
+			Labels:      MergeMap(LabelsForNginx(n.Name), n.Spec.PodTemplate.Labels),
+		},
+		Spec: coreV1.PodSpec{
+			ServiceAccountName:            n.Spec.PodTemplate.ServiceAccountName,
+			EnableServiceLinks:            func(b bool) *bool { return &b }(false),
+			InitContainers:                n.Spec.PodTemplate.InitContainers,
+			Affinity:                      n.Spec.PodTemplate.Affinity,
+			NodeSelector:                  n.Spec.PodTemplate.NodeSelector,
+			HostNetwork:                   n.Spec.PodTemplate.HostNetwork,
+			TerminationGracePeriodSeconds: n.Spec.PodTemplate.TerminationGracePeriodSeconds,
+			Volumes:                       n.Spec.PodTemplate.Volumes,
+			Tolerations:                   n.Spec.PodTemplate.Toleration,
+			ImagePullSecrets:              n.Spec.PodTemplate.ImagePullSecrets,
+			PriorityClassName:             n.Spec.PodTemplate.PriorityClassName,
+			TopologySpreadConstraints:     getTopologySpreadConstraints(n),
+			DNSPolicy:                     n.Spec.PodTemplate.DNSPolicy,
+			DNSConfig:                     n.Spec.PodTemplate.DNSConfig,
+			SecurityContext:               getPodSecurityContext(n),
+			RuntimeClassName:              n.Spec.PodTemplate.RuntimeClassName,
+			HostAliases:                   n.Spec.PodTemplate.HostAliases,
+			Containers: append([]coreV1.Container{
+				{
+					Name:            n.Name,
+					Image:           getImage(n),
+					Command:         nil,
+					Resources:       n.Spec.Resources,
+					SecurityContext: getSecurityContext(n),
+					Ports:           getContainerPorts(n),
+					Env:             n.Spec.PodTemplate.Env,
+					EnvFrom:         n.Spec.PodTemplate.EnvFrom,
+					Lifecycle:       n.Spec.PodTemplate.Lifecycle,
+					VolumeMounts:    n.Spec.PodTemplate.VolumeMounts,
+					ReadinessProbe:  getReadinessProbe(n),
+					LivenessProbe:   getLivenessProbe(n),
+					StartupProbe:    getStartupProbe(n),
+				}}, append(getExporterContainers(n), n.Spec.PodTemplate.Containers...)...),
+		},
+	}
+
+	setConfigRef(n, &template)
+	setGeneratedConfig(n, &template)
+	setCacheVolume(n, &template)
+	setUnprivilegedVolumes(n, &template)
+	setContent(n, &template)
+	setBasicAuth(n, &template)
+	setOIDC(n, &template)
+	setWAF(n, &template)
+	setErrorPages(n, &template)
+	setGracefulShutdown(n, &template)
+	return template
+}
+
 func NewDeployment(n *devopsV1.Nginx) (*appsV1.Deployment, error) {
 	deployment := appsV1.Deployment{
 		TypeMeta:   GetTypeMeta(Deployment),
-		ObjectMeta: GetObjectMeta(Deployment, n, LabelsForNginx(n.Name), getDeploymentAnnotations(n.Spec)),
+		ObjectMeta: GetObjectMeta(Deployment, n, LabelsForNginx(n.Name), getWorkloadAnnotations(n.Spec)),
 		Spec: appsV1.DeploymentSpec{
-			Strategy: getDeploymentStrategy(n),
-			Replicas: n.Spec.Replicas,
-			Selector: &metaV1.LabelSelector{MatchLabels: LabelsForNginx(n.Name)},
-			Template: coreV1.PodTemplateSpec{
-				ObjectMeta: metaV1.ObjectMeta{
-					Namespace:   n.Namespace,
-					Annotations: n.Spec.PodTemplate.Annotations,
-					Labels:      MergeMap(LabelsForNginx(n.Name), n.Spec.PodTemplate.Labels),
-				},
-				Spec: coreV1.PodSpec{
-					ServiceAccountName:            n.Spec.PodTemplate.ServiceAccountName,
-					EnableServiceLinks:            func(b bool) *bool { return &b }(false),
-					InitContainers:                n.Spec.PodTemplate.InitContainers,
-					Affinity:                      n.Spec.PodTemplate.Affinity,
-					NodeSelector:                  n.Spec.PodTemplate.NodeSelector,
-					HostNetwork:                   n.Spec.PodTemplate.HostNetwork,
-					TerminationGracePeriodSeconds: n.Spec.PodTemplate.TerminationGracePeriodSeconds,
-					Volumes:                       n.Spec.PodTemplate.Volumes,
-					Tolerations:                   n.Spec.PodTemplate.Toleration,
-					Containers: append([]coreV1.Container{
-						{
-							Name:            n.Name,
-							Image:           NewDefaultStringUtils(n.Spec.Image, defaultImage).ValueOrDefault(),
-							Command:         nil,
-							Resources:       n.Spec.Resources,
-							SecurityContext: getSecurityContext(n),
-							Ports:           getContainerPorts(n),
-							VolumeMounts:    n.Spec.PodTemplate.VolumeMounts,
-							ReadinessProbe:  getContainerProbes(n),
-						}}, n.Spec.PodTemplate.Containers...),
-				},
-			},
+			Strategy:        getDeploymentStrategy(n),
+			Replicas:        getWorkloadReplicas(n),
+			MinReadySeconds: getMinReadySeconds(n),
+			Selector:        &metaV1.LabelSelector{MatchLabels: LabelsForNginx(n.Name)},
+			Template:        newPodTemplateSpec(n),
 		},
 	}
-
-	setConfigRef(n.Spec.Config, &deployment)
 	return &deployment, nil
 }
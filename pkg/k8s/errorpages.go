@@ -0,0 +1,197 @@
+package k8s
+
+import (
+	"fmt"
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"math"
+	"net"
+	"sort"
+	"strings"
+)
+
+const (
+	errorPagesVolumeName = "nginx-error-pages"
+	errorPagesMountPath  = "/etc/nginx/operator-pages"
+	// MaintenanceFlagKey 维护模式开启时维护模式 ConfigMap 中存在该键, nginx 每个请求检查对应文件是否存在
+	MaintenanceFlagKey     = "maintenance"
+	maintenanceVariable    = "$nginx_operator_maintenance"
+	maintenanceApplies     = "$nginx_operator_maintenance_applies"
+	maintenanceClient      = "$nginx_operator_maintenance_client"
+	retryAfterVariable     = "$nginx_operator_retry_after"
+	defaultRetryAfter      = int64(300)
+	maintenanceStatusCode  = int32(503)
+	defaultMaintenancePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Service Unavailable</title>
+</head>
+<body>
+<h1>Service Unavailable</h1>
+<p>The site is down for maintenance. Please try again later.</p>
+</body>
+</html>
+`
+)
+
+func IsMaintenanceConfigured(n *devopsV1.Nginx) bool {
+	return n.Spec.Maintenance != nil
+}
+
+func IsMaintenanceEnabled(n *devopsV1.Nginx) bool {
+	return IsMaintenanceConfigured(n) && n.Spec.Maintenance.Enabled
+}
+
+func hasErrorPages(n *devopsV1.Nginx) bool {
+	return len(n.Spec.ErrorPages) > 0 || IsMaintenanceConfigured(n)
+}
+
+func getErrorPageFileName(code int32) string {
+	return fmt.Sprintf("%d.html", code)
+}
+
+func hasCustomErrorPage(n *devopsV1.Nginx, code int32) bool {
+	for _, page := range n.Spec.ErrorPages {
+		if page.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// getErrorPageCodes 返回需要替换页面的状态码, 配置维护模式时包含 503
+func getErrorPageCodes(n *devopsV1.Nginx) []int32 {
+	var codes []int32
+	for _, page := range n.Spec.ErrorPages {
+		codes = append(codes, page.Code)
+	}
+	if IsMaintenanceConfigured(n) && !hasCustomErrorPage(n, maintenanceStatusCode) {
+		codes = append(codes, maintenanceStatusCode)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+func getRetryAfterSeconds(n *devopsV1.Nginx) int64 {
+	if n.Spec.Maintenance.RetryAfter == nil {
+		return defaultRetryAfter
+	}
+	return int64(math.Ceil(n.Spec.Maintenance.RetryAfter.Duration.Seconds()))
+}
+
+// getMaintenanceHTTPSnippet 计算请求是否受维护模式影响, 允许的客户端和健康检查路径取值为空
+func getMaintenanceHTTPSnippet(n *devopsV1.Nginx) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "geo %s {\n", maintenanceClient)
+	b.WriteString("    default 1;\n")
+	for _, source := range n.Spec.Maintenance.AllowedSourceRanges {
+		fmt.Fprintf(&b, "    %s \"\";\n", source)
+	}
+	b.WriteString("}\n")
+	fmt.Fprintf(&b, "map $uri %s {\n", maintenanceApplies)
+	fmt.Fprintf(&b, "    default %s;\n", maintenanceClient)
+	for _, path := range getHealthCheckPaths(n) {
+		fmt.Fprintf(&b, "    %s \"\";\n", quoteNginxString(path))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// getErrorPagesServerSnippet 错误页面使用命名 location 返回, 命名 location 不会再次执行 server 级别的维护模式判断,
+// 状态码保持不变. 维护模式开关文件随 ConfigMap 同步, 每个请求检查一次, 切换时不需要 reload 或滚动更新
+func getErrorPagesServerSnippet(n *devopsV1.Nginx) string {
+	var b strings.Builder
+	if IsMaintenanceConfigured(n) {
+		fmt.Fprintf(&b, "set %s \"\";\n", maintenanceVariable)
+		fmt.Fprintf(&b, "set %s \"\";\n", retryAfterVariable)
+		fmt.Fprintf(&b, "if (-f %s/%s) {\n", errorPagesMountPath, MaintenanceFlagKey)
+		fmt.Fprintf(&b, "    set %s %s;\n", maintenanceVariable, maintenanceApplies)
+		b.WriteString("}\n")
+		fmt.Fprintf(&b, "if (%s) {\n", maintenanceVariable)
+		fmt.Fprintf(&b, "    set %s %d;\n", retryAfterVariable, getRetryAfterSeconds(n))
+		fmt.Fprintf(&b, "    return %d;\n", maintenanceStatusCode)
+		b.WriteString("}\n")
+	}
+	for _, code := range getErrorPageCodes(n) {
+		location := fmt.Sprintf("@nginx_operator_error_%d", code)
+		fmt.Fprintf(&b, "\nerror_page %d %s;\n", code, location)
+		fmt.Fprintf(&b, "location %s {\n", location)
+		fmt.Fprintf(&b, "    root %s;\n", errorPagesMountPath)
+		if code == maintenanceStatusCode && IsMaintenanceConfigured(n) {
+			// 变量为空时不输出该响应头, 只有维护模式返回的 503 带 Retry-After
+			fmt.Fprintf(&b, "    add_header Retry-After %s always;\n", retryAfterVariable)
+		}
+		fmt.Fprintf(&b, "    rewrite ^ /%s break;\n", getErrorPageFileName(code))
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// setErrorPages 以 projected 卷挂载用户的错误页面和维护模式 ConfigMap, 不使用 subPath, kubelet 同步后内容立即生效
+func setErrorPages(n *devopsV1.Nginx, template *coreV1.PodTemplateSpec) {
+	if !hasErrorPages(n) {
+		return
+	}
+	var sources []coreV1.VolumeProjection
+	for _, page := range n.Spec.ErrorPages {
+		sources = append(sources, coreV1.VolumeProjection{ConfigMap: &coreV1.ConfigMapProjection{
+			LocalObjectReference: coreV1.LocalObjectReference{Name: page.ConfigMapName},
+			Items:                []coreV1.KeyToPath{{Key: page.Key, Path: getErrorPageFileName(page.Code)}},
+		}})
+	}
+	if IsMaintenanceConfigured(n) {
+		sources = append(sources, coreV1.VolumeProjection{ConfigMap: &coreV1.ConfigMapProjection{
+			LocalObjectReference: coreV1.LocalObjectReference{Name: GetObjectMeta(MaintenanceConfig, n, nil, nil).Name},
+		}})
+	}
+
+	container := &template.Spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, coreV1.VolumeMount{
+		Name: errorPagesVolumeName, MountPath: errorPagesMountPath, ReadOnly: true,
+	})
+	template.Spec.Volumes = append(template.Spec.Volumes, coreV1.Volume{
+		Name:         errorPagesVolumeName,
+		VolumeSource: coreV1.VolumeSource{Projected: &coreV1.ProjectedVolumeSource{Sources: sources}},
+	})
+}
+
+// NewMaintenanceConfigMap 构建维护模式 ConfigMap, 保存默认维护页面和维护模式开关
+func NewMaintenanceConfigMap(n *devopsV1.Nginx) *coreV1.ConfigMap {
+	data := DefaultMap()
+	if !hasCustomErrorPage(n, maintenanceStatusCode) {
+		data[getErrorPageFileName(maintenanceStatusCode)] = defaultMaintenancePage
+	}
+	if IsMaintenanceEnabled(n) {
+		data[MaintenanceFlagKey] = "enabled"
+	}
+	return &coreV1.ConfigMap{
+		TypeMeta:   GetTypeMeta(MaintenanceConfig),
+		ObjectMeta: GetObjectMeta(MaintenanceConfig, n, LabelsForNginx(n.Name), DefaultMap()),
+		Data:       data,
+	}
+}
+
+// ValidateErrorPages 校验 spec.errorPages 和 spec.maintenance
+func ValidateErrorPages(n *devopsV1.Nginx) error {
+	// 同一状态码会生成重复的投影文件和命名 location, Pod 无法创建, nginx 也无法启动
+	codes := map[int32]bool{}
+	for i, page := range n.Spec.ErrorPages {
+		if page.ConfigMapName == "" || page.Key == "" {
+			return fmt.Errorf("spec.errorPages[%d]: configMapName and key are required", i)
+		}
+		if codes[page.Code] {
+			return fmt.Errorf("spec.errorPages[%d].code: duplicate code %d", i, page.Code)
+		}
+		codes[page.Code] = true
+	}
+	if !IsMaintenanceConfigured(n) {
+		return nil
+	}
+	for i, source := range n.Spec.Maintenance.AllowedSourceRanges {
+		if _, _, err := net.ParseCIDR(source); err != nil && net.ParseIP(source) == nil {
+			return fmt.Errorf("spec.maintenance.allowedSourceRanges[%d]: %q is not a valid IP or CIDR", i, source)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package k8s
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetMaintenanceSnippets(t *testing.T) {
+	n := newLimitsTestNginx(func(n *devopsV1.Nginx) {
+		n.Spec.ErrorPages = []devopsV1.NginxErrorPage{{Code: 404, ConfigMapName: "site-pages", Key: "404.html"}}
+		n.Spec.Maintenance = &devopsV1.NginxMaintenance{
+			Enabled:             true,
+			RetryAfter:          &metaV1.Duration{Duration: 10 * time.Minute},
+			AllowedSourceRanges: []string{"10.0.0.0/8"},
+		}
+	})
+
+	wantHTTP := `geo $nginx_operator_maintenance_client {
+    default 1;
+    10.0.0.0/8 "";
+}
+map $uri $nginx_operator_maintenance_applies {
+    default $nginx_operator_maintenance_client;
+    "/healthz" "";
+}
+`
+	if got := getMaintenanceHTTPSnippet(n); got != wantHTTP {
+		t.Errorf("getMaintenanceHTTPSnippet() =\n%s\nwant\n%s", got, wantHTTP)
+	}
+
+	wantServer := `set $nginx_operator_maintenance "";
+set $nginx_operator_retry_after "";
+if (-f /etc/nginx/operator-pages/maintenance) {
+    set $nginx_operator_maintenance $nginx_operator_maintenance_applies;
+}
+if ($nginx_operator_maintenance) {
+    set $nginx_operator_retry_after 600;
+    return 503;
+}
+
+error_page 404 @nginx_operator_error_404;
+location @nginx_operator_error_404 {
+    root /etc/nginx/operator-pages;
+    rewrite ^ /404.html break;
+}
+
+error_page 503 @nginx_operator_error_503;
+location @nginx_operator_error_503 {
+    root /etc/nginx/operator-pages;
+    add_header Retry-After $nginx_operator_retry_after always;
+    rewrite ^ /503.html break;
+}
+`
+	if got := getErrorPagesServerSnippet(n); got != wantServer {
+		t.Errorf("getErrorPagesServerSnippet() =\n%s\nwant\n%s", got, wantServer)
+	}
+}
+
+func TestGetErrorPagesServerSnippetWithoutMaintenance(t *testing.T) {
+	n := newLimitsTestNginx(func(n *devopsV1.Nginx) {
+		n.Spec.ErrorPages = []devopsV1.NginxErrorPage{
+			{Code: 503, ConfigMapName: "site-pages", Key: "503.html"},
+			{Code: 404, ConfigMapName: "site-pages", Key: "404.html"},
+		}
+	})
+	want := `
+error_page 404 @nginx_operator_error_404;
+location @nginx_operator_error_404 {
+    root /etc/nginx/operator-pages;
+    rewrite ^ /404.html break;
+}
+
+error_page 503 @nginx_operator_error_503;
+location @nginx_operator_error_503 {
+    root /etc/nginx/operator-pages;
+    rewrite ^ /503.html break;
+}
+`
+	if got := getErrorPagesServerSnippet(n); got != want {
+		t.Errorf("getErrorPagesServerSnippet() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNewMaintenanceConfigMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		custom   bool
+		wantKeys []string
+	}{
+		{name: "disabled with default page", wantKeys: []string{"503.html"}},
+		{name: "enabled with default page", enabled: true, wantKeys: []string{"503.html", "maintenance"}},
+		{name: "enabled with custom page", enabled: true, custom: true, wantKeys: []string{"maintenance"}},
+		{name: "disabled with custom page", custom: true, wantKeys: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.Maintenance = &devopsV1.NginxMaintenance{Enabled: tt.enabled}
+				if tt.custom {
+					n.Spec.ErrorPages = []devopsV1.NginxErrorPage{{Code: 503, ConfigMapName: "site-pages", Key: "503.html"}}
+				}
+			})
+			configMap := NewMaintenanceConfigMap(n)
+			if configMap.Name != "nginx-sample-maintenance" || configMap.Namespace != "default" {
+				t.Errorf("ConfigMap = %s/%s, want default/nginx-sample-maintenance", configMap.Namespace, configMap.Name)
+			}
+			var keys []string
+			for _, key := range []string{"503.html", MaintenanceFlagKey} {
+				if _, ok := configMap.Data[key]; ok {
+					keys = append(keys, key)
+				}
+			}
+			if len(configMap.Data) != len(keys) || !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("ConfigMap data keys = %v, want %v", configMap.Data, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestValidateErrorPages(t *testing.T) {
+	tests := []struct {
+		name    string
+		nginx   *devopsV1.Nginx
+		wantErr string
+	}{
+		{
+			name: "valid pages and maintenance",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.ErrorPages = []devopsV1.NginxErrorPage{
+					{Code: 404, ConfigMapName: "site-pages", Key: "404.html"},
+					{Code: 503, ConfigMapName: "site-pages", Key: "503.html"},
+				}
+				n.Spec.Maintenance = &devopsV1.NginxMaintenance{AllowedSourceRanges: []string{"10.0.0.0/8", "192.168.0.1"}}
+			}),
+		},
+		{
+			name: "missing key",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.ErrorPages = []devopsV1.NginxErrorPage{{Code: 404, ConfigMapName: "site-pages"}}
+			}),
+			wantErr: "spec.errorPages[0]",
+		},
+		{
+			name: "duplicate code",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.ErrorPages = []devopsV1.NginxErrorPage{
+					{Code: 404, ConfigMapName: "site-pages", Key: "404.html"},
+					{Code: 404, ConfigMapName: "other-pages", Key: "404.html"},
+				}
+			}),
+			wantErr: "spec.errorPages[1].code: duplicate",
+		},
+		{
+			name: "invalid source range",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.Maintenance = &devopsV1.NginxMaintenance{AllowedSourceRanges: []string{"10.0.0.0/33"}}
+			}),
+			wantErr: "spec.maintenance.allowedSourceRanges[0]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateErrorPages(tt.nginx)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateErrorPages() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateErrorPages() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
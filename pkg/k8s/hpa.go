@@ -0,0 +1,90 @@
+package k8s
+
+import (
+	"fmt"
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	autoscalingV2 "k8s.io/api/autoscaling/v2"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func makeUtilizationMetric(name coreV1.ResourceName, utilization *int32) autoscalingV2.MetricSpec {
+	return autoscalingV2.MetricSpec{
+		Type: autoscalingV2.ResourceMetricSourceType,
+		Resource: &autoscalingV2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingV2.MetricTarget{
+				Type:               autoscalingV2.UtilizationMetricType,
+				AverageUtilization: utilization,
+			},
+		},
+	}
+}
+
+func GetHorizontalPodAutoscalerMetrics(n *devopsV1.Nginx) []autoscalingV2.MetricSpec {
+	var metrics []autoscalingV2.MetricSpec
+	if n.Spec.Autoscaling == nil {
+		return metrics
+	}
+	if n.Spec.Autoscaling.TargetCPUUtilizationPercentage != nil {
+		metrics = append(metrics, makeUtilizationMetric(coreV1.ResourceCPU, n.Spec.Autoscaling.TargetCPUUtilizationPercentage))
+	}
+	if n.Spec.Autoscaling.TargetMemoryUtilizationPercentage != nil {
+		metrics = append(metrics, makeUtilizationMetric(coreV1.ResourceMemory, n.Spec.Autoscaling.TargetMemoryUtilizationPercentage))
+	}
+	return append(metrics, n.Spec.Autoscaling.Metrics...)
+}
+
+// IsAutoscalingEnabled 判断是否需要 HPA, DaemonSet 模式下每个节点一个 Pod, 不支持自动扩缩容
+func IsAutoscalingEnabled(n *devopsV1.Nginx) bool {
+	return n.Spec.Autoscaling != nil && GetWorkloadKind(n) != devopsV1.WorkloadKindDaemonSet
+}
+
+// ValidateAutoscaling 校验 spec.autoscaling, DaemonSet 模式下配置会被忽略, 直接拒绝
+func ValidateAutoscaling(n *devopsV1.Nginx) error {
+	if n.Spec.Autoscaling != nil && GetWorkloadKind(n) == devopsV1.WorkloadKindDaemonSet {
+		return fmt.Errorf("spec.autoscaling: not supported when workloadKind is %q", devopsV1.WorkloadKindDaemonSet)
+	}
+	return nil
+}
+
+func getScaleTargetTypeMeta(n *devopsV1.Nginx) metaV1.TypeMeta {
+	if GetWorkloadKind(n) == devopsV1.WorkloadKindStatefulSet {
+		return GetTypeMeta(StatefulSet)
+	}
+	return GetTypeMeta(Deployment)
+}
+
+func GetHorizontalPodAutoscalerMinReplicas(n *devopsV1.Nginx) *int32 {
+	if n.Spec.Autoscaling == nil || n.Spec.Autoscaling.MinReplicas == nil {
+		minReplicas := int32(1)
+		return &minReplicas
+	}
+	return n.Spec.Autoscaling.MinReplicas
+}
+
+// NewHorizontalPodAutoscaler 构建 autoscaling/v2 HPA, 直接作用于 nginx 的 Deployment 或 StatefulSet
+func NewHorizontalPodAutoscaler(n *devopsV1.Nginx) *autoscalingV2.HorizontalPodAutoscaler {
+	var maxReplicas int32
+	var behavior *autoscalingV2.HorizontalPodAutoscalerBehavior
+	if n.Spec.Autoscaling != nil {
+		maxReplicas = n.Spec.Autoscaling.MaxReplicas
+		behavior = n.Spec.Autoscaling.Behavior
+	}
+	targetTypeMeta := getScaleTargetTypeMeta(n)
+	return &autoscalingV2.HorizontalPodAutoscaler{
+		TypeMeta:   GetTypeMeta(HorizontalPodAutoscaler),
+		ObjectMeta: GetObjectMeta(HorizontalPodAutoscaler, n, LabelsForNginx(n.Name), DefaultMap()),
+		Spec: autoscalingV2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingV2.CrossVersionObjectReference{
+				APIVersion: targetTypeMeta.APIVersion,
+				Kind:       targetTypeMeta.Kind,
+				Name:       n.Name,
+			},
+			MinReplicas: GetHorizontalPodAutoscalerMinReplicas(n),
+			MaxReplicas: maxReplicas,
+			Metrics:     GetHorizontalPodAutoscalerMetrics(n),
+			Behavior:    behavior,
+		},
+	}
+}
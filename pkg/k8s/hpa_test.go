@@ -0,0 +1,27 @@
+package k8s
+
+import (
+	"testing"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+)
+
+func TestValidateAutoscaling(t *testing.T) {
+	tests := []struct {
+		kind    devopsV1.WorkloadKind
+		wantErr bool
+	}{
+		{"", false},
+		{devopsV1.WorkloadKindStatefulSet, false},
+		{devopsV1.WorkloadKindDaemonSet, true},
+	}
+	for _, tt := range tests {
+		n := newLimitsTestNginx(func(n *devopsV1.Nginx) {
+			n.Spec.WorkloadKind = tt.kind
+			n.Spec.Autoscaling = &devopsV1.NginxAutoscaling{}
+		})
+		if err := ValidateAutoscaling(n); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateAutoscaling() with workloadKind %q = %v, want error %t", tt.kind, err, tt.wantErr)
+		}
+	}
+}
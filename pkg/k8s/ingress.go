@@ -1,11 +1,67 @@
 package k8s
 
 import (
-	"fmt"
 	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	"github.com/tomoncle/k8s-operator-nginx/pkg/k8s/ingressprofile"
 	networkingV1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
+func getIngressProfile(n *devopsV1.Nginx) ingressprofile.Translator {
+	if n.Spec.Ingress == nil {
+		return nil
+	}
+	return ingressprofile.Get(n.Spec.Ingress.Profile)
+}
+
+// translateIngressFeatures 将 spec.ingress.features 和在 Ingress 上执行的认证, 限流翻译为所选 ingress 控制器的配置
+func translateIngressFeatures(n *devopsV1.Nginx) ingressprofile.Result {
+	translator := getIngressProfile(n)
+	if translator == nil {
+		return ingressprofile.Result{}
+	}
+	features := n.Spec.Ingress.Features
+	rateLimits := ingressprofile.IngressRateLimits(n)
+	if features == nil {
+		if ingressprofile.IngressBasicAuth(n) == nil && ingressprofile.IngressOIDCAuth(n) == nil &&
+			ingressprofile.IngressConnectionLimits(n) == nil && len(rateLimits) == 0 {
+			return ingressprofile.Result{}
+		}
+		features = &devopsV1.NginxIngressFeatures{}
+	}
+	// 校验保证在 Ingress 上最多一个限流, 速率合法, 且不与 features.rateLimit 同时配置
+	if len(rateLimits) > 0 && features.RateLimit == nil {
+		if rateLimit, err := getIngressRateLimit(rateLimits[0]); err == nil {
+			features = features.DeepCopy()
+			features.RateLimit = rateLimit
+		}
+	}
+	return translator.Translate(n, features)
+}
+
+// GetUnsupportedIngressFeatures 返回所选 ingress 控制器不支持的 features
+func GetUnsupportedIngressFeatures(n *devopsV1.Nginx) []string {
+	return translateIngressFeatures(n).Unsupported
+}
+
+// GetIngressFeatureObjects 返回实现 features 需要的额外资源(例如 Traefik Middleware)
+func GetIngressFeatureObjects(n *devopsV1.Nginx) []*unstructured.Unstructured {
+	objects := translateIngressFeatures(n).Objects
+	for _, obj := range objects {
+		meta := GetObjectMeta(Ingress, n, GetIngressLabels(n), nil)
+		obj.SetLabels(meta.Labels)
+		obj.SetOwnerReferences(meta.OwnerReferences)
+	}
+	return objects
+}
+
+func getIngressBackendPortName(n *devopsV1.Nginx) string {
+	if n.Spec.Ingress != nil && ingressprofile.IsTLSBackend(n.Spec.Ingress.Features) {
+		return defaultHTTPSPortName
+	}
+	return defaultHTTPPortName
+}
+
 func GetIngressLabels(n *devopsV1.Nginx) map[string]string {
 	labels := LabelsForNginx(n.Name)
 	if n.Spec.Ingress != nil {
@@ -14,12 +70,16 @@ func GetIngressLabels(n *devopsV1.Nginx) map[string]string {
 	return labels
 }
 
+// GetIngressAnnotations 用户设置的注解优先于 features 翻译得到的注解
 func GetIngressAnnotations(n *devopsV1.Nginx) map[string]string {
-	var annotations map[string]string
-	if n.Spec.Ingress != nil {
-		annotations = MergeMap(n.Spec.Ingress.Annotations, annotations)
+	if n.Spec.Ingress == nil {
+		return nil
+	}
+	annotations := translateIngressFeatures(n).Annotations
+	if len(annotations) == 0 {
+		return n.Spec.Ingress.Annotations
 	}
-	return annotations
+	return MergeMap(annotations, n.Spec.Ingress.Annotations)
 }
 
 func GetIngressClassName(n *devopsV1.Nginx) *string {
@@ -30,6 +90,9 @@ func GetIngressClassName(n *devopsV1.Nginx) *string {
 		return n.Spec.Ingress.IngressClassName
 	}
 	defaultIngressClassName := "nginx"
+	if translator := getIngressProfile(n); translator != nil {
+		defaultIngressClassName = translator.IngressClassName()
+	}
 	return &defaultIngressClassName
 }
 
@@ -46,9 +109,9 @@ func GetIngressRule(n *devopsV1.Nginx, path, host string) networkingV1.IngressRu
 						}(networkingV1.PathTypePrefix),
 						Backend: networkingV1.IngressBackend{
 							Service: &networkingV1.IngressServiceBackend{
-								Name: fmt.Sprintf("%s-service", n.Name),
+								Name: GetServiceName(n, GetPrimaryService(n).NameSuffix),
 								Port: networkingV1.ServiceBackendPort{
-									Name: defaultHTTPPortName,
+									Name: getIngressBackendPortName(n),
 								},
 							},
 						},
@@ -93,9 +156,9 @@ func getIngressTLS(n *devopsV1.Nginx) []networkingV1.IngressTLS {
 func GetIngressDefaultBackend(n *devopsV1.Nginx) *networkingV1.IngressBackend {
 	defaultBackend := &networkingV1.IngressBackend{
 		Service: &networkingV1.IngressServiceBackend{
-			Name: fmt.Sprintf("%s-service", n.Name),
+			Name: GetServiceName(n, GetPrimaryService(n).NameSuffix),
 			Port: networkingV1.ServiceBackendPort{
-				Name: defaultHTTPPortName,
+				Name: getIngressBackendPortName(n),
 			},
 		},
 	}
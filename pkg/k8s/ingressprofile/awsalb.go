@@ -0,0 +1,91 @@
+package ingressprofile
+
+import (
+	"fmt"
+	"strings"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+)
+
+const albPrefix = "alb.ingress.kubernetes.io/"
+
+func init() {
+	Register(devopsV1.IngressProfileAWSALB, awsALB{})
+}
+
+// awsALB https://kubernetes-sigs.github.io/aws-load-balancer-controller/latest/guide/ingress/annotations/
+type awsALB struct{}
+
+func (awsALB) IngressClassName() string {
+	return "alb"
+}
+
+// SupportsAuth ALB 的认证需要 Cognito 或 IdP 配置, 无法通过 operator 生成的资源实现
+func (awsALB) SupportsAuth(AuthKind) bool {
+	return false
+}
+
+// SupportsLimit ALB 没有按客户端的限流, 需要使用 AWS WAF
+func (awsALB) SupportsLimit(LimitKind) bool {
+	return false
+}
+
+func (awsALB) Translate(n *devopsV1.Nginx, f *devopsV1.NginxIngressFeatures) Result {
+	result := newResult()
+	set := func(key, value string) {
+		result.Annotations[albPrefix+key] = value
+	}
+
+	if f.ProxyBodySize != nil {
+		result.unsupported("proxyBodySize")
+	}
+	if t := f.Timeouts; t != nil {
+		if t.Connect != nil {
+			result.unsupported("timeouts.connect")
+		}
+		// ALB 只有一个空闲超时, 取读写超时中较大的值
+		var idle int64
+		if t.Read != nil {
+			idle = seconds(t.Read)
+		}
+		if t.Send != nil && seconds(t.Send) > idle {
+			idle = seconds(t.Send)
+		}
+		if idle > 0 {
+			set("load-balancer-attributes", fmt.Sprintf("idle_timeout.timeout_seconds=%d", idle))
+		}
+	}
+	if f.SSLRedirect != nil && *f.SSLRedirect {
+		set("listen-ports", `[{"HTTP": 80}, {"HTTPS": 443}]`)
+		set("ssl-redirect", "443")
+	}
+	if f.CORS != nil {
+		result.unsupported("cors")
+	}
+	if f.RateLimit != nil {
+		result.unsupported(string(LimitRate))
+	}
+	if IngressConnectionLimits(n) != nil {
+		result.unsupported(string(LimitConnections))
+	}
+	if IngressBasicAuth(n) != nil {
+		result.unsupported(string(AuthBasic))
+	}
+	if IngressOIDCAuth(n) != nil {
+		result.unsupported(string(AuthOIDC))
+	}
+	if len(f.WhitelistSourceRange) > 0 {
+		set("inbound-cidrs", strings.Join(f.WhitelistSourceRange, ","))
+	}
+	switch f.BackendProtocol {
+	case "HTTP", "HTTPS":
+		set("backend-protocol", f.BackendProtocol)
+	case "GRPC":
+		set("backend-protocol", "HTTP")
+		set("backend-protocol-version", "GRPC")
+	case "GRPCS":
+		set("backend-protocol", "HTTPS")
+		set("backend-protocol-version", "GRPC")
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package ingressprofile
+
+import (
+	"testing"
+	"time"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+)
+
+func TestAWSALBTranslate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(n *devopsV1.Nginx)
+		features    devopsV1.NginxIngressFeatures
+		annotations map[string]string
+		unsupported []string
+	}{
+		{
+			name:     "no features",
+			features: devopsV1.NginxIngressFeatures{},
+		},
+		{
+			name: "idle timeout uses the larger of read and send",
+			features: devopsV1.NginxIngressFeatures{
+				Timeouts: &devopsV1.NginxIngressTimeouts{
+					Connect: durationPtr(5 * time.Second), Read: durationPtr(time.Minute), Send: durationPtr(2 * time.Minute),
+				},
+			},
+			annotations: map[string]string{
+				"alb.ingress.kubernetes.io/load-balancer-attributes": "idle_timeout.timeout_seconds=120",
+			},
+			unsupported: []string{"timeouts.connect"},
+		},
+		{
+			name:     "ssl redirect",
+			features: devopsV1.NginxIngressFeatures{SSLRedirect: boolPtr(true)},
+			annotations: map[string]string{
+				"alb.ingress.kubernetes.io/listen-ports": `[{"HTTP": 80}, {"HTTPS": 443}]`,
+				"alb.ingress.kubernetes.io/ssl-redirect": "443",
+			},
+		},
+		{
+			name:   "unsupported features",
+			mutate: connectionLimitsByIngress,
+			features: devopsV1.NginxIngressFeatures{
+				ProxyBodySize: quantityPtr("8Mi"),
+				CORS:          &devopsV1.NginxIngressCORS{},
+				RateLimit:     &devopsV1.NginxIngressRateLimit{RequestsPerSecond: 10},
+			},
+			unsupported: []string{"proxyBodySize", "cors", "rateLimit", "connectionLimits"},
+		},
+		{
+			name:        "basic auth is unsupported",
+			mutate:      basicAuthByIngress,
+			unsupported: []string{"auth.basic"},
+		},
+		{
+			name:        "oidc is unsupported",
+			mutate:      oidcByIngress,
+			unsupported: []string{"auth.oidc"},
+		},
+		{
+			name:     "allowlist and grpc backend",
+			features: devopsV1.NginxIngressFeatures{WhitelistSourceRange: []string{"10.0.0.0/8"}, BackendProtocol: "GRPC"},
+			annotations: map[string]string{
+				"alb.ingress.kubernetes.io/inbound-cidrs":            "10.0.0.0/8",
+				"alb.ingress.kubernetes.io/backend-protocol":         "HTTP",
+				"alb.ingress.kubernetes.io/backend-protocol-version": "GRPC",
+			},
+		},
+		{
+			name:     "https backend",
+			features: devopsV1.NginxIngressFeatures{BackendProtocol: "HTTPS"},
+			annotations: map[string]string{
+				"alb.ingress.kubernetes.io/backend-protocol": "HTTPS",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := awsALB{}.Translate(newTestNginx(tt.mutate), &tt.features)
+			checkResult(t, result, tt.annotations, nil, tt.unsupported)
+			if len(result.Objects) > 0 {
+				t.Errorf("Objects = %v, want none", result.Objects)
+			}
+		})
+	}
+}
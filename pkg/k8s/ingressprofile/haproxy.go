@@ -0,0 +1,104 @@
+package ingressprofile
+
+import (
+	"strconv"
+	"strings"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+)
+
+const haproxyPrefix = "haproxy-ingress.github.io/"
+
+func init() {
+	Register(devopsV1.IngressProfileHAProxy, haproxy{})
+}
+
+// haproxy https://haproxy-ingress.github.io/docs/configuration/keys/
+type haproxy struct{}
+
+func (haproxy) IngressClassName() string {
+	return "haproxy"
+}
+
+// SupportsAuth haproxy 使用系统 crypt() 校验密码, 不支持 operator 生成的 apr1 哈希, 也不支持 OIDC
+func (haproxy) SupportsAuth(AuthKind) bool {
+	return false
+}
+
+// SupportsLimit haproxy-ingress 的 limit-rps 没有 burst
+func (haproxy) SupportsLimit(kind LimitKind) bool {
+	return kind != LimitRateBurst
+}
+
+func (haproxy) Translate(n *devopsV1.Nginx, f *devopsV1.NginxIngressFeatures) Result {
+	result := newResult()
+	set := func(key, value string) {
+		result.Annotations[haproxyPrefix+key] = value
+	}
+
+	if f.ProxyBodySize != nil {
+		set("proxy-body-size", strconv.FormatInt(f.ProxyBodySize.Value(), 10))
+	}
+	if t := f.Timeouts; t != nil {
+		if t.Connect != nil {
+			set("timeout-connect", secondsString(t.Connect)+"s")
+		}
+		if t.Read != nil {
+			set("timeout-server", secondsString(t.Read)+"s")
+		}
+		if t.Send != nil {
+			// haproxy 的 timeout server 同时作用于读写
+			result.unsupported("timeouts.send")
+		}
+	}
+	if f.SSLRedirect != nil {
+		set("ssl-redirect", strconv.FormatBool(*f.SSLRedirect))
+	}
+	if c := f.CORS; c != nil {
+		set("cors-enable", "true")
+		if len(c.AllowOrigins) > 0 {
+			set("cors-allow-origin", strings.Join(c.AllowOrigins, ","))
+		}
+		if len(c.AllowMethods) > 0 {
+			set("cors-allow-methods", strings.Join(c.AllowMethods, ","))
+		}
+		if len(c.AllowHeaders) > 0 {
+			set("cors-allow-headers", strings.Join(c.AllowHeaders, ","))
+		}
+		if c.AllowCredentials {
+			set("cors-allow-credentials", "true")
+		}
+		if c.MaxAge != nil {
+			set("cors-max-age", strconv.Itoa(int(*c.MaxAge)))
+		}
+	}
+	if rl := f.RateLimit; rl != nil {
+		set("limit-rps", strconv.Itoa(int(rl.RequestsPerSecond)))
+		if rl.Burst != nil {
+			result.unsupported(string(LimitRateBurst))
+		}
+	}
+	if cl := IngressConnectionLimits(n); cl != nil {
+		set("limit-connections", strconv.Itoa(int(cl.PerClient)))
+	}
+	if IngressBasicAuth(n) != nil {
+		result.unsupported(string(AuthBasic))
+	}
+	if IngressOIDCAuth(n) != nil {
+		result.unsupported(string(AuthOIDC))
+	}
+	if len(f.WhitelistSourceRange) > 0 {
+		set("allowlist-source-range", strings.Join(f.WhitelistSourceRange, ","))
+	}
+	switch f.BackendProtocol {
+	case "HTTP":
+		set("backend-protocol", "h1")
+	case "HTTPS":
+		set("backend-protocol", "h1-ssl")
+	case "GRPC":
+		set("backend-protocol", "h2")
+	case "GRPCS":
+		set("backend-protocol", "h2-ssl")
+	}
+	return result
+}
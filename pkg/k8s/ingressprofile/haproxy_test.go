@@ -0,0 +1,94 @@
+package ingressprofile
+
+import (
+	"testing"
+	"time"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+)
+
+func TestHAProxyTranslate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(n *devopsV1.Nginx)
+		features    devopsV1.NginxIngressFeatures
+		annotations map[string]string
+		unsupported []string
+	}{
+		{
+			name:     "no features",
+			features: devopsV1.NginxIngressFeatures{},
+		},
+		{
+			name: "body size, timeouts and redirect",
+			features: devopsV1.NginxIngressFeatures{
+				ProxyBodySize: quantityPtr("1Mi"),
+				Timeouts: &devopsV1.NginxIngressTimeouts{
+					Connect: durationPtr(5 * time.Second), Read: durationPtr(time.Minute), Send: durationPtr(time.Minute),
+				},
+				SSLRedirect: boolPtr(true),
+			},
+			annotations: map[string]string{
+				"haproxy-ingress.github.io/proxy-body-size": "1048576",
+				"haproxy-ingress.github.io/timeout-connect": "5s",
+				"haproxy-ingress.github.io/timeout-server":  "60s",
+				"haproxy-ingress.github.io/ssl-redirect":    "true",
+			},
+			unsupported: []string{"timeouts.send"},
+		},
+		{
+			name: "cors",
+			features: devopsV1.NginxIngressFeatures{CORS: &devopsV1.NginxIngressCORS{
+				AllowOrigins: []string{"https://a.example.com", "https://b.example.com"}, AllowMethods: []string{"GET", "POST"},
+				MaxAge: int32Ptr(600),
+			}},
+			annotations: map[string]string{
+				"haproxy-ingress.github.io/cors-enable":        "true",
+				"haproxy-ingress.github.io/cors-allow-origin":  "https://a.example.com,https://b.example.com",
+				"haproxy-ingress.github.io/cors-allow-methods": "GET,POST",
+				"haproxy-ingress.github.io/cors-max-age":       "600",
+			},
+		},
+		{
+			name:   "rate limit burst is unsupported",
+			mutate: connectionLimitsByIngress,
+			features: devopsV1.NginxIngressFeatures{
+				RateLimit: &devopsV1.NginxIngressRateLimit{RequestsPerSecond: 10, Burst: int32Ptr(25)},
+			},
+			annotations: map[string]string{
+				"haproxy-ingress.github.io/limit-rps":         "10",
+				"haproxy-ingress.github.io/limit-connections": "20",
+			},
+			unsupported: []string{"rateLimit.burst"},
+		},
+		{
+			name:        "basic auth is unsupported",
+			mutate:      basicAuthByIngress,
+			unsupported: []string{"auth.basic"},
+		},
+		{
+			name:        "oidc is unsupported",
+			mutate:      oidcByIngress,
+			unsupported: []string{"auth.oidc"},
+		},
+		{
+			name: "allowlist and backend protocol",
+			features: devopsV1.NginxIngressFeatures{
+				WhitelistSourceRange: []string{"10.0.0.0/8", "192.168.0.1"}, BackendProtocol: "GRPCS",
+			},
+			annotations: map[string]string{
+				"haproxy-ingress.github.io/allowlist-source-range": "10.0.0.0/8,192.168.0.1",
+				"haproxy-ingress.github.io/backend-protocol":       "h2-ssl",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := haproxy{}.Translate(newTestNginx(tt.mutate), &tt.features)
+			checkResult(t, result, tt.annotations, nil, tt.unsupported)
+			if len(result.Objects) > 0 {
+				t.Errorf("Objects = %v, want none", result.Objects)
+			}
+		})
+	}
+}
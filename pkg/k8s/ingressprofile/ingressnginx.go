@@ -0,0 +1,105 @@
+package ingressprofile
+
+import (
+	"strconv"
+	"strings"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+)
+
+const ingressNginxPrefix = "nginx.ingress.kubernetes.io/"
+
+func init() {
+	Register(devopsV1.IngressProfileIngressNginx, ingressNginx{})
+}
+
+// ingressNginx https://kubernetes.github.io/ingress-nginx/user-guide/nginx-configuration/annotations/
+type ingressNginx struct{}
+
+func (ingressNginx) IngressClassName() string {
+	return "nginx"
+}
+
+func (ingressNginx) SupportsAuth(AuthKind) bool {
+	return true
+}
+
+func (ingressNginx) SupportsLimit(LimitKind) bool {
+	return true
+}
+
+func (ingressNginx) Translate(n *devopsV1.Nginx, f *devopsV1.NginxIngressFeatures) Result {
+	result := newResult()
+	set := func(key, value string) {
+		result.Annotations[ingressNginxPrefix+key] = value
+	}
+
+	if f.ProxyBodySize != nil {
+		set("proxy-body-size", NginxSize(f.ProxyBodySize))
+	}
+	if t := f.Timeouts; t != nil {
+		if t.Connect != nil {
+			set("proxy-connect-timeout", secondsString(t.Connect))
+		}
+		if t.Read != nil {
+			set("proxy-read-timeout", secondsString(t.Read))
+		}
+		if t.Send != nil {
+			set("proxy-send-timeout", secondsString(t.Send))
+		}
+	}
+	if f.SSLRedirect != nil {
+		set("ssl-redirect", strconv.FormatBool(*f.SSLRedirect))
+	}
+	if c := f.CORS; c != nil {
+		set("enable-cors", "true")
+		if len(c.AllowOrigins) > 0 {
+			set("cors-allow-origin", strings.Join(c.AllowOrigins, ", "))
+		}
+		if len(c.AllowMethods) > 0 {
+			set("cors-allow-methods", strings.Join(c.AllowMethods, ", "))
+		}
+		if len(c.AllowHeaders) > 0 {
+			set("cors-allow-headers", strings.Join(c.AllowHeaders, ", "))
+		}
+		if c.AllowCredentials {
+			set("cors-allow-credentials", "true")
+		}
+		if c.MaxAge != nil {
+			set("cors-max-age", strconv.Itoa(int(*c.MaxAge)))
+		}
+	}
+	if rl := f.RateLimit; rl != nil {
+		set("limit-rps", strconv.Itoa(int(rl.RequestsPerSecond)))
+		// ingress-nginx 的 burst 是 rps 的倍数
+		if rl.Burst != nil && rl.RequestsPerSecond > 0 {
+			multiplier := (*rl.Burst + rl.RequestsPerSecond - 1) / rl.RequestsPerSecond
+			if multiplier < 1 {
+				multiplier = 1
+			}
+			set("limit-burst-multiplier", strconv.Itoa(int(multiplier)))
+		}
+	}
+	if cl := IngressConnectionLimits(n); cl != nil {
+		set("limit-connections", strconv.Itoa(int(cl.PerClient)))
+	}
+	if auth := IngressBasicAuth(n); auth != nil {
+		set("auth-type", "basic")
+		set("auth-secret", BasicAuthSecretName(n))
+		set("auth-secret-type", "auth-file")
+		set("auth-realm", BasicAuthRealm(auth))
+	}
+	if IngressOIDCAuth(n) != nil {
+		// 登录路径由单独的 Ingress 转发到 oauth2-proxy
+		set("auth-url", "https://$host"+OAuth2ProxyPathPrefix+"/auth")
+		set("auth-signin", "https://$host"+OAuth2ProxyPathPrefix+"/start?rd=$escaped_request_uri")
+		set("auth-response-headers", "X-Auth-Request-User,X-Auth-Request-Email")
+	}
+	if len(f.WhitelistSourceRange) > 0 {
+		set("whitelist-source-range", strings.Join(f.WhitelistSourceRange, ","))
+	}
+	if f.BackendProtocol != "" {
+		set("backend-protocol", f.BackendProtocol)
+	}
+	return result
+}
@@ -0,0 +1,111 @@
+package ingressprofile
+
+import (
+	"testing"
+	"time"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+)
+
+func TestIngressNginxTranslate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(n *devopsV1.Nginx)
+		features    devopsV1.NginxIngressFeatures
+		annotations map[string]string
+	}{
+		{
+			name:     "no features",
+			features: devopsV1.NginxIngressFeatures{},
+		},
+		{
+			name: "body size, timeouts and redirect",
+			features: devopsV1.NginxIngressFeatures{
+				ProxyBodySize: quantityPtr("8Mi"),
+				Timeouts: &devopsV1.NginxIngressTimeouts{
+					Connect: durationPtr(5 * time.Second), Read: durationPtr(1500 * time.Millisecond), Send: durationPtr(time.Minute),
+				},
+				SSLRedirect: boolPtr(false),
+			},
+			annotations: map[string]string{
+				"nginx.ingress.kubernetes.io/proxy-body-size":       "8m",
+				"nginx.ingress.kubernetes.io/proxy-connect-timeout": "5",
+				"nginx.ingress.kubernetes.io/proxy-read-timeout":    "2",
+				"nginx.ingress.kubernetes.io/proxy-send-timeout":    "60",
+				"nginx.ingress.kubernetes.io/ssl-redirect":          "false",
+			},
+		},
+		{
+			name: "cors",
+			features: devopsV1.NginxIngressFeatures{CORS: &devopsV1.NginxIngressCORS{
+				AllowOrigins: []string{"https://a.example.com", "https://b.example.com"}, AllowMethods: []string{"GET", "POST"},
+				AllowHeaders: []string{"Authorization"}, AllowCredentials: true, MaxAge: int32Ptr(600),
+			}},
+			annotations: map[string]string{
+				"nginx.ingress.kubernetes.io/enable-cors":            "true",
+				"nginx.ingress.kubernetes.io/cors-allow-origin":      "https://a.example.com, https://b.example.com",
+				"nginx.ingress.kubernetes.io/cors-allow-methods":     "GET, POST",
+				"nginx.ingress.kubernetes.io/cors-allow-headers":     "Authorization",
+				"nginx.ingress.kubernetes.io/cors-allow-credentials": "true",
+				"nginx.ingress.kubernetes.io/cors-max-age":           "600",
+			},
+		},
+		{
+			name:   "rate and connection limits",
+			mutate: connectionLimitsByIngress,
+			features: devopsV1.NginxIngressFeatures{
+				RateLimit: &devopsV1.NginxIngressRateLimit{RequestsPerSecond: 10, Burst: int32Ptr(25)},
+			},
+			annotations: map[string]string{
+				"nginx.ingress.kubernetes.io/limit-rps":              "10",
+				"nginx.ingress.kubernetes.io/limit-burst-multiplier": "3",
+				"nginx.ingress.kubernetes.io/limit-connections":      "20",
+			},
+		},
+		{
+			name:   "basic auth",
+			mutate: basicAuthByIngress,
+			annotations: map[string]string{
+				"nginx.ingress.kubernetes.io/auth-type":        "basic",
+				"nginx.ingress.kubernetes.io/auth-secret":      "docs-basic-auth",
+				"nginx.ingress.kubernetes.io/auth-secret-type": "auth-file",
+				"nginx.ingress.kubernetes.io/auth-realm":       "Docs",
+			},
+		},
+		{
+			name:   "oidc",
+			mutate: oidcByIngress,
+			annotations: map[string]string{
+				"nginx.ingress.kubernetes.io/auth-url":              "https://$host/oauth2/auth",
+				"nginx.ingress.kubernetes.io/auth-signin":           "https://$host/oauth2/start?rd=$escaped_request_uri",
+				"nginx.ingress.kubernetes.io/auth-response-headers": "X-Auth-Request-User,X-Auth-Request-Email",
+			},
+		},
+		{
+			name: "basic auth enforced by nginx is ignored",
+			mutate: func(n *devopsV1.Nginx) {
+				basicAuthByIngress(n)
+				n.Spec.Auth.Basic.EnforcedBy = devopsV1.EnforcementNginx
+			},
+		},
+		{
+			name: "allowlist and backend protocol",
+			features: devopsV1.NginxIngressFeatures{
+				WhitelistSourceRange: []string{"10.0.0.0/8", "192.168.0.1"}, BackendProtocol: "GRPCS",
+			},
+			annotations: map[string]string{
+				"nginx.ingress.kubernetes.io/whitelist-source-range": "10.0.0.0/8,192.168.0.1",
+				"nginx.ingress.kubernetes.io/backend-protocol":       "GRPCS",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ingressNginx{}.Translate(newTestNginx(tt.mutate), &tt.features)
+			checkResult(t, result, tt.annotations, nil, nil)
+			if len(result.Objects) > 0 {
+				t.Errorf("Objects = %v, want none", result.Objects)
+			}
+		})
+	}
+}
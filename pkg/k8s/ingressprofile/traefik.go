@@ -0,0 +1,135 @@
+package ingressprofile
+
+import (
+	"fmt"
+	"strings"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// TraefikMiddlewareGVK Traefik v3 的 Middleware, 以 unstructured 方式处理, 避免依赖其 API 包
+var TraefikMiddlewareGVK = schema.GroupVersionKind{
+	Group:   "traefik.io",
+	Version: "v1alpha1",
+	Kind:    "Middleware",
+}
+
+func init() {
+	Register(devopsV1.IngressProfileTraefik, traefik{})
+}
+
+// traefik 大部分功能需要通过 Middleware 实现, Ingress 上通过 router.middlewares 注解引用
+// https://doc.traefik.io/traefik/routing/providers/kubernetes-ingress/
+type traefik struct{}
+
+func (traefik) IngressClassName() string {
+	return "traefik"
+}
+
+// SupportsAuth Traefik 的 forwardAuth 需要额外配置 oauth2-proxy 的路由, 暂不支持 OIDC
+func (traefik) SupportsAuth(kind AuthKind) bool {
+	return kind == AuthBasic
+}
+
+func (traefik) SupportsLimit(LimitKind) bool {
+	return true
+}
+
+func (traefik) Translate(n *devopsV1.Nginx, f *devopsV1.NginxIngressFeatures) Result {
+	result := newResult()
+	var middlewares []string
+	addMiddleware := func(suffix string, spec map[string]interface{}) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(TraefikMiddlewareGVK)
+		obj.SetName(fmt.Sprintf("%s-%s", n.Name, suffix))
+		obj.SetNamespace(n.Namespace)
+		obj.Object["spec"] = spec
+		result.Objects = append(result.Objects, obj)
+		middlewares = append(middlewares, fmt.Sprintf("%s-%s@kubernetescrd", obj.GetNamespace(), obj.GetName()))
+	}
+
+	if f.SSLRedirect != nil && *f.SSLRedirect {
+		addMiddleware("redirect-https", map[string]interface{}{
+			"redirectScheme": map[string]interface{}{"scheme": "https", "permanent": true},
+		})
+	}
+	if auth := IngressBasicAuth(n); auth != nil {
+		addMiddleware("basic-auth", map[string]interface{}{
+			"basicAuth": map[string]interface{}{"secret": BasicAuthSecretName(n), "realm": BasicAuthRealm(auth)},
+		})
+	}
+	if IngressOIDCAuth(n) != nil {
+		result.unsupported(string(AuthOIDC))
+	}
+	if len(f.WhitelistSourceRange) > 0 {
+		addMiddleware("allowlist", map[string]interface{}{
+			"ipAllowList": map[string]interface{}{"sourceRange": toInterfaceSlice(f.WhitelistSourceRange)},
+		})
+	}
+	if rl := f.RateLimit; rl != nil {
+		rateLimit := map[string]interface{}{"average": int64(rl.RequestsPerSecond), "period": "1s"}
+		if rl.Burst != nil {
+			rateLimit["burst"] = int64(*rl.Burst)
+		}
+		addMiddleware("ratelimit", map[string]interface{}{"rateLimit": rateLimit})
+	}
+	if cl := IngressConnectionLimits(n); cl != nil {
+		// 未指定 ipStrategy 时 Traefik 按请求来源地址统计
+		addMiddleware("inflightreq", map[string]interface{}{
+			"inFlightReq": map[string]interface{}{
+				"amount":          int64(cl.PerClient),
+				"sourceCriterion": map[string]interface{}{"ipStrategy": map[string]interface{}{}},
+			},
+		})
+	}
+	if f.ProxyBodySize != nil {
+		addMiddleware("buffering", map[string]interface{}{
+			"buffering": map[string]interface{}{"maxRequestBodyBytes": f.ProxyBodySize.Value()},
+		})
+	}
+	if c := f.CORS; c != nil {
+		origins := c.AllowOrigins
+		if len(origins) == 0 {
+			origins = []string{"*"}
+		}
+		headers := map[string]interface{}{"accessControlAllowOriginList": toInterfaceSlice(origins)}
+		if len(c.AllowMethods) > 0 {
+			headers["accessControlAllowMethods"] = toInterfaceSlice(c.AllowMethods)
+		}
+		if len(c.AllowHeaders) > 0 {
+			headers["accessControlAllowHeaders"] = toInterfaceSlice(c.AllowHeaders)
+		}
+		if c.AllowCredentials {
+			headers["accessControlAllowCredentials"] = true
+		}
+		if c.MaxAge != nil {
+			headers["accessControlMaxAge"] = int64(*c.MaxAge)
+		}
+		addMiddleware("cors", map[string]interface{}{"headers": headers})
+	}
+	if f.Timeouts != nil {
+		// Traefik 的超时在 ServersTransport 或 entryPoint 上配置, 无法通过 Ingress 设置
+		result.unsupported("timeouts")
+	}
+
+	if len(middlewares) > 0 {
+		result.Annotations["traefik.ingress.kubernetes.io/router.middlewares"] = strings.Join(middlewares, ",")
+	}
+	switch f.BackendProtocol {
+	case "HTTPS", "GRPCS":
+		result.ServiceAnnotations["traefik.ingress.kubernetes.io/service.serversscheme"] = "https"
+	case "GRPC":
+		result.ServiceAnnotations["traefik.ingress.kubernetes.io/service.serversscheme"] = "h2c"
+	}
+	return result
+}
+
+func toInterfaceSlice(values []string) []interface{} {
+	out := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		out = append(out, v)
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package ingressprofile
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+)
+
+func TestTraefikTranslate(t *testing.T) {
+	const middlewaresAnnotation = "traefik.ingress.kubernetes.io/router.middlewares"
+
+	tests := []struct {
+		name               string
+		mutate             func(n *devopsV1.Nginx)
+		features           devopsV1.NginxIngressFeatures
+		middlewares        map[string]map[string]interface{}
+		annotations        map[string]string
+		serviceAnnotations map[string]string
+		unsupported        []string
+	}{
+		{
+			name:     "no features",
+			features: devopsV1.NginxIngressFeatures{},
+		},
+		{
+			name:     "redirect disabled creates no middleware",
+			features: devopsV1.NginxIngressFeatures{SSLRedirect: boolPtr(false)},
+		},
+		{
+			name:   "middlewares are referenced in order",
+			mutate: basicAuthByIngress,
+			features: devopsV1.NginxIngressFeatures{
+				SSLRedirect:          boolPtr(true),
+				WhitelistSourceRange: []string{"10.0.0.0/8"},
+			},
+			middlewares: map[string]map[string]interface{}{
+				"docs-redirect-https": {"redirectScheme": map[string]interface{}{"scheme": "https", "permanent": true}},
+				"docs-basic-auth":     {"basicAuth": map[string]interface{}{"secret": "docs-basic-auth", "realm": "Docs"}},
+				"docs-allowlist":      {"ipAllowList": map[string]interface{}{"sourceRange": []interface{}{"10.0.0.0/8"}}},
+			},
+			annotations: map[string]string{
+				middlewaresAnnotation: "web-docs-redirect-https@kubernetescrd,web-docs-basic-auth@kubernetescrd,web-docs-allowlist@kubernetescrd",
+			},
+		},
+		{
+			name:   "rate and connection limits",
+			mutate: connectionLimitsByIngress,
+			features: devopsV1.NginxIngressFeatures{
+				RateLimit: &devopsV1.NginxIngressRateLimit{RequestsPerSecond: 10, Burst: int32Ptr(25)},
+			},
+			middlewares: map[string]map[string]interface{}{
+				"docs-ratelimit": {"rateLimit": map[string]interface{}{"average": int64(10), "period": "1s", "burst": int64(25)}},
+				"docs-inflightreq": {"inFlightReq": map[string]interface{}{
+					"amount":          int64(20),
+					"sourceCriterion": map[string]interface{}{"ipStrategy": map[string]interface{}{}},
+				}},
+			},
+			annotations: map[string]string{
+				middlewaresAnnotation: "web-docs-ratelimit@kubernetescrd,web-docs-inflightreq@kubernetescrd",
+			},
+		},
+		{
+			name: "body size and cors",
+			features: devopsV1.NginxIngressFeatures{
+				ProxyBodySize: quantityPtr("8Mi"),
+				CORS:          &devopsV1.NginxIngressCORS{AllowMethods: []string{"GET"}, AllowCredentials: true, MaxAge: int32Ptr(600)},
+			},
+			middlewares: map[string]map[string]interface{}{
+				"docs-buffering": {"buffering": map[string]interface{}{"maxRequestBodyBytes": int64(8 << 20)}},
+				"docs-cors": {"headers": map[string]interface{}{
+					"accessControlAllowOriginList":  []interface{}{"*"},
+					"accessControlAllowMethods":     []interface{}{"GET"},
+					"accessControlAllowCredentials": true,
+					"accessControlMaxAge":           int64(600),
+				}},
+			},
+			annotations: map[string]string{
+				middlewaresAnnotation: "web-docs-buffering@kubernetescrd,web-docs-cors@kubernetescrd",
+			},
+		},
+		{
+			name:        "oidc and timeouts are unsupported",
+			mutate:      oidcByIngress,
+			features:    devopsV1.NginxIngressFeatures{Timeouts: &devopsV1.NginxIngressTimeouts{Read: durationPtr(time.Minute)}},
+			unsupported: []string{"auth.oidc", "timeouts"},
+		},
+		{
+			name:               "https backend",
+			features:           devopsV1.NginxIngressFeatures{BackendProtocol: "HTTPS"},
+			serviceAnnotations: map[string]string{"traefik.ingress.kubernetes.io/service.serversscheme": "https"},
+		},
+		{
+			name:               "grpc backend",
+			features:           devopsV1.NginxIngressFeatures{BackendProtocol: "GRPC"},
+			serviceAnnotations: map[string]string{"traefik.ingress.kubernetes.io/service.serversscheme": "h2c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := traefik{}.Translate(newTestNginx(tt.mutate), &tt.features)
+			checkResult(t, result, tt.annotations, tt.serviceAnnotations, tt.unsupported)
+
+			if len(result.Objects) != len(tt.middlewares) {
+				t.Fatalf("got %d middlewares, want %d", len(result.Objects), len(tt.middlewares))
+			}
+			for _, obj := range result.Objects {
+				if obj.GroupVersionKind() != TraefikMiddlewareGVK || obj.GetNamespace() != "web" {
+					t.Errorf("middleware %s/%s has kind %v", obj.GetNamespace(), obj.GetName(), obj.GroupVersionKind())
+				}
+				want, ok := tt.middlewares[obj.GetName()]
+				if !ok {
+					t.Errorf("unexpected middleware %s", obj.GetName())
+					continue
+				}
+				if !reflect.DeepEqual(obj.Object["spec"], want) {
+					t.Errorf("middleware %s spec = %v, want %v", obj.GetName(), obj.Object["spec"], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+// Package ingressprofile 将 spec.ingress.features 翻译为不同 ingress 控制器的注解或资源,
+// 新的控制器实现 Translator 接口后通过 Register 注册即可.
+package ingressprofile
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Result 翻译结果
+type Result struct {
+	// Annotations 需要添加到 Ingress 上的注解
+	Annotations map[string]string
+	// ServiceAnnotations 需要添加到 nginx Service 上的注解
+	ServiceAnnotations map[string]string
+	// Objects 控制器需要的额外资源, 例如 Traefik 的 Middleware, 由调用方设置 owner 和 labels
+	Objects []*unstructured.Unstructured
+	// Unsupported 当前控制器不支持, 被忽略的功能
+	Unsupported []string
+}
+
+// AuthKind 在 Ingress 上执行的认证类型, 同时作为 Result.Unsupported 中的名称
+type AuthKind string
+
+const (
+	AuthBasic = AuthKind("auth.basic")
+	AuthOIDC  = AuthKind("auth.oidc")
+)
+
+// LimitKind 在 Ingress 上执行的限流能力, 同时作为 Result.Unsupported 中的名称
+type LimitKind string
+
+const (
+	LimitRate        = LimitKind("rateLimit")
+	LimitRateBurst   = LimitKind("rateLimit.burst")
+	LimitConnections = LimitKind("connectionLimits")
+)
+
+// Translator 将 features 翻译为某个 ingress 控制器的配置
+type Translator interface {
+	// IngressClassName 未指定 ingressClassName 时使用的默认值
+	IngressClassName() string
+	// SupportsAuth 能否在 Ingress 上执行该类型的认证. 认证不能像其他 features 一样忽略,
+	// 否则站点会在未认证的情况下对外服务, 不支持时由校验拒绝该配置
+	SupportsAuth(kind AuthKind) bool
+	// SupportsLimit 能否在 Ingress 上执行 spec.rateLimits 和 spec.connectionLimits, 与认证相同, 不支持时由校验拒绝
+	SupportsLimit(kind LimitKind) bool
+	// Translate features 不为空, 同时翻译在 Ingress 上执行的 n.Spec.Auth 和 n.Spec.ConnectionLimits,
+	// 在 Ingress 上执行的 n.Spec.RateLimits 由调用方合并到 features.RateLimit
+	Translate(n *devopsV1.Nginx, features *devopsV1.NginxIngressFeatures) Result
+}
+
+var translators = map[devopsV1.IngressProfile]Translator{}
+
+// Register 注册 profile 对应的 Translator
+func Register(profile devopsV1.IngressProfile, translator Translator) {
+	translators[profile] = translator
+}
+
+// Get 返回 profile 对应的 Translator, 默认为 ingress-nginx, 未注册时返回 nil
+func Get(profile devopsV1.IngressProfile) Translator {
+	if profile == "" {
+		profile = devopsV1.IngressProfileIngressNginx
+	}
+	return translators[profile]
+}
+
+func newResult() Result {
+	return Result{Annotations: map[string]string{}, ServiceAnnotations: map[string]string{}}
+}
+
+func (r *Result) unsupported(feature string) {
+	r.Unsupported = append(r.Unsupported, feature)
+}
+
+// seconds 将 Duration 向上取整为秒
+func seconds(d *metaV1.Duration) int64 {
+	return int64(math.Ceil(d.Duration.Seconds()))
+}
+
+func secondsString(d *metaV1.Duration) string {
+	return strconv.FormatInt(seconds(d), 10)
+}
+
+// NginxSize 将 Quantity 转换为 nginx 的 size 格式, 例如 8m, 512k
+func NginxSize(q *resource.Quantity) string {
+	bytes := q.Value()
+	switch {
+	case bytes == 0:
+		return "0"
+	case bytes%(1<<20) == 0:
+		return fmt.Sprintf("%dm", bytes>>20)
+	case bytes%(1<<10) == 0:
+		return fmt.Sprintf("%dk", bytes>>10)
+	default:
+		return strconv.FormatInt(bytes, 10)
+	}
+}
+
+func isTLSBackend(protocol string) bool {
+	return protocol == "HTTPS" || protocol == "GRPCS"
+}
+
+// IsTLSBackend 后端协议为 HTTPS/GRPCS 时 Ingress 需要转发到 nginx 的 https 端口
+func IsTLSBackend(features *devopsV1.NginxIngressFeatures) bool {
+	return features != nil && isTLSBackend(features.BackendProtocol)
+}
+
+// DefaultBasicAuthRealm 未设置 realm 时使用的认证提示
+const DefaultBasicAuthRealm = "Restricted"
+
+// BasicAuthSecretName operator 生成的 htpasswd Secret, "auth" 键供 ingress-nginx 使用, "users" 键供 Traefik 使用
+func BasicAuthSecretName(n *devopsV1.Nginx) string {
+	return fmt.Sprintf("%s-basic-auth", n.Name)
+}
+
+// BasicAuthRealm 返回认证提示
+func BasicAuthRealm(auth *devopsV1.NginxBasicAuth) string {
+	if auth.Realm == "" {
+		return DefaultBasicAuthRealm
+	}
+	return auth.Realm
+}
+
+// IngressBasicAuth 由 ingress 控制器执行 basic 认证时返回其配置, 否则返回 nil
+func IngressBasicAuth(n *devopsV1.Nginx) *devopsV1.NginxBasicAuth {
+	if n.Spec.Auth == nil || n.Spec.Auth.Basic == nil || n.Spec.Auth.Basic.EnforcedBy != devopsV1.EnforcementIngress {
+		return nil
+	}
+	return n.Spec.Auth.Basic
+}
+
+// OAuth2ProxyPathPrefix oauth2-proxy 处理登录和认证的路径前缀
+const OAuth2ProxyPathPrefix = "/oauth2"
+
+// IngressOIDCAuth 由 ingress 控制器调用 oauth2-proxy 认证时返回其配置, 否则返回 nil
+func IngressOIDCAuth(n *devopsV1.Nginx) *devopsV1.NginxOIDCAuth {
+	if n.Spec.Auth == nil || n.Spec.Auth.OIDC == nil || n.Spec.Auth.OIDC.EnforcedBy != devopsV1.EnforcementIngress {
+		return nil
+	}
+	return n.Spec.Auth.OIDC
+}
+
+// IngressRateLimits 返回由 ingress 控制器执行的请求限流
+func IngressRateLimits(n *devopsV1.Nginx) []devopsV1.NginxRateLimit {
+	var limits []devopsV1.NginxRateLimit
+	for _, limit := range n.Spec.RateLimits {
+		if limit.EnforcedBy == devopsV1.EnforcementIngress {
+			limits = append(limits, limit)
+		}
+	}
+	return limits
+}
+
+// IngressConnectionLimits 由 ingress 控制器限制并发连接数时返回其配置, 否则返回 nil
+func IngressConnectionLimits(n *devopsV1.Nginx) *devopsV1.NginxConnectionLimits {
+	if n.Spec.ConnectionLimits == nil || n.Spec.ConnectionLimits.EnforcedBy != devopsV1.EnforcementIngress {
+		return nil
+	}
+	return n.Spec.ConnectionLimits
+}
+
+// ObjectKinds 所有 Translator 可能生成的额外资源类型, 用于清理不再需要的资源
+var ObjectKinds = []schema.GroupVersionKind{
+	TraefikMiddlewareGVK,
+}
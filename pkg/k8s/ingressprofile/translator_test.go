@@ -0,0 +1,152 @@
+package ingressprofile
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestNginx(mutate func(n *devopsV1.Nginx)) *devopsV1.Nginx {
+	n := &devopsV1.Nginx{ObjectMeta: metaV1.ObjectMeta{Name: "docs", Namespace: "web"}}
+	if mutate != nil {
+		mutate(n)
+	}
+	return n
+}
+
+func basicAuthByIngress(n *devopsV1.Nginx) {
+	n.Spec.Auth = &devopsV1.NginxAuth{Basic: &devopsV1.NginxBasicAuth{
+		SecretName: "docs-users", Realm: "Docs", EnforcedBy: devopsV1.EnforcementIngress,
+	}}
+}
+
+func oidcByIngress(n *devopsV1.Nginx) {
+	n.Spec.Auth = &devopsV1.NginxAuth{OIDC: &devopsV1.NginxOIDCAuth{
+		IssuerURL: "https://accounts.example.com", ClientID: "docs", ClientSecretName: "docs-oidc",
+		EnforcedBy: devopsV1.EnforcementIngress,
+	}}
+}
+
+func connectionLimitsByIngress(n *devopsV1.Nginx) {
+	n.Spec.ConnectionLimits = &devopsV1.NginxConnectionLimits{PerClient: 20, EnforcedBy: devopsV1.EnforcementIngress}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func durationPtr(d time.Duration) *metaV1.Duration {
+	return &metaV1.Duration{Duration: d}
+}
+
+func quantityPtr(s string) *resource.Quantity {
+	q := resource.MustParse(s)
+	return &q
+}
+
+// checkResult 比较注解和不支持的功能, 空 map 与 nil 视为相同
+func checkResult(t *testing.T, got Result, annotations, serviceAnnotations map[string]string, unsupported []string) {
+	t.Helper()
+	if len(got.Annotations) != len(annotations) || (len(annotations) > 0 && !reflect.DeepEqual(got.Annotations, annotations)) {
+		t.Errorf("Annotations = %v, want %v", got.Annotations, annotations)
+	}
+	if len(got.ServiceAnnotations) != len(serviceAnnotations) ||
+		(len(serviceAnnotations) > 0 && !reflect.DeepEqual(got.ServiceAnnotations, serviceAnnotations)) {
+		t.Errorf("ServiceAnnotations = %v, want %v", got.ServiceAnnotations, serviceAnnotations)
+	}
+	if !reflect.DeepEqual(got.Unsupported, unsupported) {
+		t.Errorf("Unsupported = %q, want %q", got.Unsupported, unsupported)
+	}
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		profile   devopsV1.IngressProfile
+		className string
+	}{
+		{"", "nginx"},
+		{devopsV1.IngressProfileIngressNginx, "nginx"},
+		{devopsV1.IngressProfileTraefik, "traefik"},
+		{devopsV1.IngressProfileHAProxy, "haproxy"},
+		{devopsV1.IngressProfileAWSALB, "alb"},
+	}
+	for _, tt := range tests {
+		translator := Get(tt.profile)
+		if translator == nil {
+			t.Errorf("Get(%q) = nil", tt.profile)
+			continue
+		}
+		if got := translator.IngressClassName(); got != tt.className {
+			t.Errorf("Get(%q).IngressClassName() = %q, want %q", tt.profile, got, tt.className)
+		}
+	}
+	if Get("istio") != nil {
+		t.Error(`Get("istio") = non-nil, want nil for an unregistered profile`)
+	}
+}
+
+func TestSupportsAuth(t *testing.T) {
+	tests := []struct {
+		profile     devopsV1.IngressProfile
+		basic, oidc bool
+	}{
+		{devopsV1.IngressProfileIngressNginx, true, true},
+		{devopsV1.IngressProfileTraefik, true, false},
+		{devopsV1.IngressProfileHAProxy, false, false},
+		{devopsV1.IngressProfileAWSALB, false, false},
+	}
+	for _, tt := range tests {
+		translator := Get(tt.profile)
+		if got := translator.SupportsAuth(AuthBasic); got != tt.basic {
+			t.Errorf("%s SupportsAuth(AuthBasic) = %t, want %t", tt.profile, got, tt.basic)
+		}
+		if got := translator.SupportsAuth(AuthOIDC); got != tt.oidc {
+			t.Errorf("%s SupportsAuth(AuthOIDC) = %t, want %t", tt.profile, got, tt.oidc)
+		}
+	}
+}
+
+func TestSupportsLimit(t *testing.T) {
+	tests := []struct {
+		profile                  devopsV1.IngressProfile
+		rate, burst, connections bool
+	}{
+		{devopsV1.IngressProfileIngressNginx, true, true, true},
+		{devopsV1.IngressProfileTraefik, true, true, true},
+		{devopsV1.IngressProfileHAProxy, true, false, true},
+		{devopsV1.IngressProfileAWSALB, false, false, false},
+	}
+	for _, tt := range tests {
+		translator := Get(tt.profile)
+		for kind, want := range map[LimitKind]bool{LimitRate: tt.rate, LimitRateBurst: tt.burst, LimitConnections: tt.connections} {
+			if got := translator.SupportsLimit(kind); got != want {
+				t.Errorf("%s SupportsLimit(%s) = %t, want %t", tt.profile, kind, got, want)
+			}
+		}
+	}
+}
+
+func TestNginxSize(t *testing.T) {
+	tests := []struct {
+		quantity, want string
+	}{
+		{"0", "0"},
+		{"8Mi", "8m"},
+		{"512Ki", "512k"},
+		{"1500", "1500"},
+		{"1G", "1000000000"},
+	}
+	for _, tt := range tests {
+		if got := NginxSize(quantityPtr(tt.quantity)); got != tt.want {
+			t.Errorf("NginxSize(%s) = %q, want %q", tt.quantity, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package k8s
+
+import (
+	"fmt"
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	"github.com/tomoncle/k8s-operator-nginx/pkg/k8s/ingressprofile"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	rateLimitVariablePrefix = "$nginx_operator_rate_limit_"
+	connectionLimitVariable = "$nginx_operator_conn_limit"
+	connectionLimitZone     = "operator_conn"
+	limitRejectStatus       = 429
+)
+
+var (
+	defaultLimitZoneSize = resource.MustParse("10Mi")
+	// rateLimitPattern 与 CRD 中 rate 字段的校验一致, 例如 10r/s, 300r/m
+	rateLimitPattern = regexp.MustCompile(`^([1-9][0-9]*)r/([sm])$`)
+)
+
+// parseRate 解析 nginx 的速率, 返回请求数和时间单位 s 或 m
+func parseRate(rate string) (int32, string, error) {
+	match := rateLimitPattern.FindStringSubmatch(rate)
+	if match == nil {
+		return 0, "", fmt.Errorf("invalid rate %q, expected <requests>r/s or <requests>r/m", rate)
+	}
+	requests, err := strconv.ParseInt(match[1], 10, 32)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid rate %q: %w", rate, err)
+	}
+	return int32(requests), match[2], nil
+}
+
+// getNginxRateLimits 返回在 nginx 中执行的请求限流, 未指定 enforcedBy 时在 nginx 中执行
+func getNginxRateLimits(n *devopsV1.Nginx) []devopsV1.NginxRateLimit {
+	var limits []devopsV1.NginxRateLimit
+	for _, limit := range n.Spec.RateLimits {
+		if limit.EnforcedBy != devopsV1.EnforcementIngress {
+			limits = append(limits, limit)
+		}
+	}
+	return limits
+}
+
+func isConnectionLimitEnforcedByNginx(n *devopsV1.Nginx) bool {
+	return n.Spec.ConnectionLimits != nil && n.Spec.ConnectionLimits.EnforcedBy != devopsV1.EnforcementIngress
+}
+
+// hasNginxLimits 是否需要在生成的配置中渲染限流
+func hasNginxLimits(n *devopsV1.Nginx) bool {
+	return len(getNginxRateLimits(n)) > 0 || isConnectionLimitEnforcedByNginx(n)
+}
+
+func getLimitZoneSize(size *resource.Quantity) string {
+	if size == nil {
+		size = &defaultLimitZoneSize
+	}
+	return ingressprofile.NginxSize(size)
+}
+
+// getRateLimitKey 返回限流统计使用的 nginx 变量, 请求头名称转换为 $http_ 变量
+func getRateLimitKey(limit devopsV1.NginxRateLimit) string {
+	if limit.Key == devopsV1.RateLimitKeyHeader {
+		return "$http_" + strings.ReplaceAll(strings.ToLower(limit.Header), "-", "_")
+	}
+	return "$binary_remote_addr"
+}
+
+// writeLimitKeyMap 通过 map 按 $uri 计算限流的 key, 取值为空字符串的请求不计入限流,
+// 健康检查路径不限流, 避免 kubelet 检查被拒绝
+func writeLimitKeyMap(b *strings.Builder, variable, key string, paths []string, healthCheckPaths []string) {
+	fmt.Fprintf(b, "map $uri %s {\n", variable)
+	if len(paths) == 0 {
+		fmt.Fprintf(b, "    default %s;\n", key)
+	} else {
+		b.WriteString("    default \"\";\n")
+	}
+	// 精确匹配优先于正则匹配
+	for _, path := range healthCheckPaths {
+		fmt.Fprintf(b, "    %s \"\";\n", quoteNginxString(path))
+	}
+	for _, path := range paths {
+		fmt.Fprintf(b, "    %s %s;\n", quoteNginxString("~^"+regexp.QuoteMeta(path)), key)
+	}
+	b.WriteString("}\n")
+}
+
+// getLimitsSnippet 渲染 limit_req_zone/limit_req 和 limit_conn_zone/limit_conn, 在 http 块中生效,
+// 无需修改用户的 server 配置
+func getLimitsSnippet(n *devopsV1.Nginx) string {
+	healthCheckPaths := getHealthCheckPaths(n)
+
+	var b strings.Builder
+	rateLimits := getNginxRateLimits(n)
+	for _, limit := range rateLimits {
+		variable := rateLimitVariablePrefix + limit.Name
+		writeLimitKeyMap(&b, variable, getRateLimitKey(limit), limit.Paths, healthCheckPaths)
+		fmt.Fprintf(&b, "limit_req_zone %s zone=operator_%s:%s rate=%s;\n",
+			variable, limit.Name, getLimitZoneSize(limit.ZoneSize), limit.Rate)
+		fmt.Fprintf(&b, "limit_req zone=operator_%s burst=%d", limit.Name, limit.Burst)
+		if limit.NoDelay {
+			b.WriteString(" nodelay")
+		}
+		b.WriteString(";\n")
+	}
+	if len(rateLimits) > 0 {
+		fmt.Fprintf(&b, "limit_req_status %d;\n", limitRejectStatus)
+	}
+
+	if isConnectionLimitEnforcedByNginx(n) {
+		cl := n.Spec.ConnectionLimits
+		writeLimitKeyMap(&b, connectionLimitVariable, "$binary_remote_addr", nil, healthCheckPaths)
+		fmt.Fprintf(&b, "limit_conn_zone %s zone=%s:%s;\n",
+			connectionLimitVariable, connectionLimitZone, getLimitZoneSize(cl.ZoneSize))
+		fmt.Fprintf(&b, "limit_conn %s %d;\n", connectionLimitZone, cl.PerClient)
+		fmt.Fprintf(&b, "limit_conn_status %d;\n", limitRejectStatus)
+	}
+	return b.String()
+}
+
+// getIngressRateLimit 将在 Ingress 上执行的限流转换为 features.rateLimit, ingress 控制器只支持以 r/s 为单位
+func getIngressRateLimit(limit devopsV1.NginxRateLimit) (*devopsV1.NginxIngressRateLimit, error) {
+	requests, unit, err := parseRate(limit.Rate)
+	if err != nil {
+		return nil, err
+	}
+	if unit != "s" {
+		return nil, fmt.Errorf("only r/s is supported when enforced by Ingress, got %q", limit.Rate)
+	}
+	rateLimit := &devopsV1.NginxIngressRateLimit{RequestsPerSecond: requests}
+	if limit.Burst > 0 {
+		burst := limit.Burst
+		rateLimit.Burst = &burst
+	}
+	return rateLimit, nil
+}
+
+// ValidateLimits 校验 spec.rateLimits 和 spec.connectionLimits
+func ValidateLimits(n *devopsV1.Nginx) error {
+	names := map[string]bool{}
+	ingressRateLimits := 0
+	for i, limit := range n.Spec.RateLimits {
+		field := fmt.Sprintf("spec.rateLimits[%d]", i)
+		if names[limit.Name] {
+			return fmt.Errorf("%s.name: duplicate name %q", field, limit.Name)
+		}
+		names[limit.Name] = true
+		if _, _, err := parseRate(limit.Rate); err != nil {
+			return fmt.Errorf("%s.rate: %w", field, err)
+		}
+		if limit.Key == devopsV1.RateLimitKeyHeader {
+			if errs := validation.IsHTTPHeaderName(limit.Header); limit.Header == "" || len(errs) > 0 {
+				return fmt.Errorf("%s.header: a valid header name is required when key is Header", field)
+			}
+		}
+		for _, path := range limit.Paths {
+			if !strings.HasPrefix(path, "/") {
+				return fmt.Errorf("%s.paths: %q must start with /", field, path)
+			}
+		}
+		if limit.EnforcedBy != devopsV1.EnforcementIngress {
+			continue
+		}
+
+		// ingress 控制器只支持按客户端 IP, 以每秒请求数对整个 Ingress 限流
+		if n.Spec.Ingress == nil {
+			return fmt.Errorf("%s.enforcedBy: Ingress requires spec.ingress", field)
+		}
+		if limit.Key == devopsV1.RateLimitKeyHeader {
+			return fmt.Errorf("%s.key: only ClientIP is supported when enforced by Ingress", field)
+		}
+		if len(limit.Paths) > 0 {
+			return fmt.Errorf("%s.paths: only supported when enforced by Nginx", field)
+		}
+		if _, err := getIngressRateLimit(limit); err != nil {
+			return fmt.Errorf("%s.rate: %w", field, err)
+		}
+		if err := validateIngressLimit(n, field+".enforcedBy", ingressprofile.LimitRate); err != nil {
+			return err
+		}
+		if limit.Burst > 0 {
+			if err := validateIngressLimit(n, field+".burst", ingressprofile.LimitRateBurst); err != nil {
+				return err
+			}
+		}
+		if ingressRateLimits++; ingressRateLimits > 1 {
+			return fmt.Errorf("%s.enforcedBy: at most one rate limit can be enforced by Ingress", field)
+		}
+		if n.Spec.Ingress.Features != nil && n.Spec.Ingress.Features.RateLimit != nil {
+			return fmt.Errorf("%s.enforcedBy: conflicts with spec.ingress.features.rateLimit", field)
+		}
+	}
+
+	if cl := n.Spec.ConnectionLimits; cl != nil && cl.EnforcedBy == devopsV1.EnforcementIngress {
+		if n.Spec.Ingress == nil {
+			return fmt.Errorf("spec.connectionLimits.enforcedBy: Ingress requires spec.ingress")
+		}
+		return validateIngressLimit(n, "spec.connectionLimits.enforcedBy", ingressprofile.LimitConnections)
+	}
+	return nil
+}
+
+// validateIngressLimit 与认证相同, ingress 控制器不支持时不能只产生 warning 事件, 否则实例在没有限流的情况下对外服务
+func validateIngressLimit(n *devopsV1.Nginx, field string, kind ingressprofile.LimitKind) error {
+	if translator := getIngressProfile(n); translator == nil || !translator.SupportsLimit(kind) {
+		return fmt.Errorf("%s: %s enforced by Ingress is not supported by ingress profile %q", field, kind, n.Spec.Ingress.Profile)
+	}
+	return nil
+}
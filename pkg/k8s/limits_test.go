@@ -0,0 +1,231 @@
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newLimitsTestNginx(mutate func(n *devopsV1.Nginx)) *devopsV1.Nginx {
+	n := &devopsV1.Nginx{
+		ObjectMeta: metaV1.ObjectMeta{Name: "nginx-sample", Namespace: "default"},
+		Spec:       devopsV1.NginxSpec{HealthcheckPath: "/healthz"},
+	}
+	if mutate != nil {
+		mutate(n)
+	}
+	return n
+}
+
+func TestGetLimitsSnippet(t *testing.T) {
+	zoneSize := resource.MustParse("1Mi")
+
+	tests := []struct {
+		name  string
+		nginx *devopsV1.Nginx
+		want  string
+	}{
+		{
+			name: "client ip rate limit on all paths",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{{Name: "all", Rate: "10r/s", Burst: 20, NoDelay: true}}
+			}),
+			want: `map $uri $nginx_operator_rate_limit_all {
+    default $binary_remote_addr;
+    "/healthz" "";
+}
+limit_req_zone $nginx_operator_rate_limit_all zone=operator_all:10m rate=10r/s;
+limit_req zone=operator_all burst=20 nodelay;
+limit_req_status 429;
+`,
+		},
+		{
+			name: "header rate limit on selected paths",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{{
+					Name: "api", Key: devopsV1.RateLimitKeyHeader, Header: "X-Api-Key", Rate: "300r/m",
+					ZoneSize: &zoneSize, Paths: []string{"/api/v1.0"},
+				}}
+			}),
+			want: `map $uri $nginx_operator_rate_limit_api {
+    default "";
+    "/healthz" "";
+    "~^/api/v1\\.0" $http_x_api_key;
+}
+limit_req_zone $nginx_operator_rate_limit_api zone=operator_api:1m rate=300r/m;
+limit_req zone=operator_api burst=0;
+limit_req_status 429;
+`,
+		},
+		{
+			name: "ingress rate limits are not rendered",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{{Name: "edge", Rate: "5r/s", EnforcedBy: devopsV1.EnforcementIngress}}
+				n.Spec.ConnectionLimits = &devopsV1.NginxConnectionLimits{PerClient: 10}
+			}),
+			want: `map $uri $nginx_operator_conn_limit {
+    default $binary_remote_addr;
+    "/healthz" "";
+}
+limit_conn_zone $nginx_operator_conn_limit zone=operator_conn:10m;
+limit_conn operator_conn 10;
+limit_conn_status 429;
+`,
+		},
+		{
+			name: "probe paths are exempt too",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.Probes = &devopsV1.NginxProbes{Liveness: &devopsV1.NginxProbe{Path: "/livez"}}
+				n.Spec.ConnectionLimits = &devopsV1.NginxConnectionLimits{PerClient: 2, ZoneSize: &zoneSize}
+			}),
+			want: `map $uri $nginx_operator_conn_limit {
+    default $binary_remote_addr;
+    "/healthz" "";
+    "/livez" "";
+}
+limit_conn_zone $nginx_operator_conn_limit zone=operator_conn:1m;
+limit_conn operator_conn 2;
+limit_conn_status 429;
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getLimitsSnippet(tt.nginx); got != tt.want {
+				t.Errorf("getLimitsSnippet() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLimits(t *testing.T) {
+	ingress := func(n *devopsV1.Nginx) { n.Spec.Ingress = &devopsV1.NginxIngress{} }
+
+	tests := []struct {
+		name    string
+		nginx   *devopsV1.Nginx
+		wantErr string
+	}{
+		{
+			name: "valid nginx and ingress limits",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				ingress(n)
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{
+					{Name: "api", Rate: "300r/m", Paths: []string{"/api"}},
+					{Name: "edge", Rate: "10r/s", EnforcedBy: devopsV1.EnforcementIngress},
+				}
+			}),
+		},
+		{
+			name: "fractional rate",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{{Name: "api", Rate: "1.5r/s"}}
+			}),
+			wantErr: "spec.rateLimits[0].rate",
+		},
+		{
+			name: "leading space in rate",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{{Name: "api", Rate: " 10r/s"}}
+			}),
+			wantErr: "spec.rateLimits[0].rate",
+		},
+		{
+			name: "duplicate names",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{{Name: "api", Rate: "1r/s"}, {Name: "api", Rate: "2r/s"}}
+			}),
+			wantErr: "spec.rateLimits[1].name",
+		},
+		{
+			name: "header key without header",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{{Name: "api", Key: devopsV1.RateLimitKeyHeader, Rate: "1r/s"}}
+			}),
+			wantErr: "spec.rateLimits[0].header",
+		},
+		{
+			name: "ingress rate limit per minute",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				ingress(n)
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{{Name: "edge", Rate: "60r/m", EnforcedBy: devopsV1.EnforcementIngress}}
+			}),
+			wantErr: "only r/s is supported",
+		},
+		{
+			name: "two ingress rate limits",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				ingress(n)
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{
+					{Name: "a", Rate: "1r/s", EnforcedBy: devopsV1.EnforcementIngress},
+					{Name: "b", Rate: "2r/s", EnforcedBy: devopsV1.EnforcementIngress},
+				}
+			}),
+			wantErr: "at most one",
+		},
+		{
+			name: "haproxy rate limit without burst",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.Ingress = &devopsV1.NginxIngress{Profile: devopsV1.IngressProfileHAProxy}
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{{Name: "edge", Rate: "10r/s", EnforcedBy: devopsV1.EnforcementIngress}}
+				n.Spec.ConnectionLimits = &devopsV1.NginxConnectionLimits{PerClient: 1, EnforcedBy: devopsV1.EnforcementIngress}
+			}),
+		},
+		{
+			name: "haproxy rate limit burst",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.Ingress = &devopsV1.NginxIngress{Profile: devopsV1.IngressProfileHAProxy}
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{{Name: "edge", Rate: "10r/s", Burst: 5, EnforcedBy: devopsV1.EnforcementIngress}}
+			}),
+			wantErr: "spec.rateLimits[0].burst",
+		},
+		{
+			name: "aws-alb rate limit",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.Ingress = &devopsV1.NginxIngress{Profile: devopsV1.IngressProfileAWSALB}
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{{Name: "edge", Rate: "10r/s", EnforcedBy: devopsV1.EnforcementIngress}}
+			}),
+			wantErr: "spec.rateLimits[0].enforcedBy",
+		},
+		{
+			name: "aws-alb connection limits",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.Ingress = &devopsV1.NginxIngress{Profile: devopsV1.IngressProfileAWSALB}
+				n.Spec.ConnectionLimits = &devopsV1.NginxConnectionLimits{PerClient: 1, EnforcedBy: devopsV1.EnforcementIngress}
+			}),
+			wantErr: "spec.connectionLimits.enforcedBy",
+		},
+		{
+			name: "aws-alb limits enforced by nginx",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.Ingress = &devopsV1.NginxIngress{Profile: devopsV1.IngressProfileAWSALB}
+				n.Spec.RateLimits = []devopsV1.NginxRateLimit{{Name: "all", Rate: "10r/s", Burst: 5}}
+				n.Spec.ConnectionLimits = &devopsV1.NginxConnectionLimits{PerClient: 1}
+			}),
+		},
+		{
+			name: "ingress connection limits without ingress",
+			nginx: newLimitsTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.ConnectionLimits = &devopsV1.NginxConnectionLimits{PerClient: 1, EnforcedBy: devopsV1.EnforcementIngress}
+			}),
+			wantErr: "spec.connectionLimits.enforcedBy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateLimits(tt.nginx)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateLimits() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateLimits() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package k8s
+
+import (
+	"fmt"
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	defaultExporterImage  = "nginx/nginx-prometheus-exporter:0.11.0"
+	defaultMetricsPort    = int32(9113)
+	defaultMetricsName    = "metrics"
+	defaultStubStatusPort = int32(8090)
+	exporterContainerName = "nginx-exporter"
+	stubStatusPath        = "/stub_status"
+)
+
+// ServiceMonitorGVK Prometheus Operator 的 ServiceMonitor, 以 unstructured 方式处理, 避免依赖其 API 包
+var ServiceMonitorGVK = schema.GroupVersionKind{
+	Group:   "monitoring.coreos.com",
+	Version: "v1",
+	Kind:    "ServiceMonitor",
+}
+
+func IsMonitoringEnabled(n *devopsV1.Nginx) bool {
+	return n.Spec.Monitoring != nil && n.Spec.Monitoring.Enabled
+}
+
+func getMetricsPort(n *devopsV1.Nginx) int32 {
+	if n.Spec.Monitoring == nil || n.Spec.Monitoring.Port == 0 {
+		return defaultMetricsPort
+	}
+	return n.Spec.Monitoring.Port
+}
+
+func getStubStatusPort(n *devopsV1.Nginx) int32 {
+	if n.Spec.Monitoring == nil || n.Spec.Monitoring.StubStatusPort == 0 {
+		return defaultStubStatusPort
+	}
+	return n.Spec.Monitoring.StubStatusPort
+}
+
+// getStubStatusSnippet 只允许 Pod 内部(exporter sidecar)访问的 stub_status 服务
+func getStubStatusSnippet(n *devopsV1.Nginx) string {
+	return fmt.Sprintf(`server {
+    listen %d;
+    location = %s {
+        stub_status;
+        access_log off;
+        auth_basic off;
+        allow 127.0.0.1;
+        deny all;
+    }
+}
+`, getStubStatusPort(n), stubStatusPath)
+}
+
+// getExporterContainers 返回需要注入 nginx Pod 的 exporter sidecar
+func getExporterContainers(n *devopsV1.Nginx) []coreV1.Container {
+	if !IsMonitoringEnabled(n) {
+		return nil
+	}
+	metricsPort := getMetricsPort(n)
+	var securityContext *coreV1.SecurityContext
+	if IsUnprivileged(n) {
+		securityContext = getRestrictedSecurityContext(nil)
+	}
+	return []coreV1.Container{
+		{
+			Name:  exporterContainerName,
+			Image: NewDefaultStringUtils(n.Spec.Monitoring.Image, defaultExporterImage).ValueOrDefault(),
+			Args: []string{
+				fmt.Sprintf("-nginx.scrape-uri=http://127.0.0.1:%d%s", getStubStatusPort(n), stubStatusPath),
+				fmt.Sprintf("-web.listen-address=:%d", metricsPort),
+			},
+			Ports:           []coreV1.ContainerPort{makeContainerPort(defaultMetricsName, metricsPort)},
+			Resources:       n.Spec.Monitoring.Resources,
+			SecurityContext: securityContext,
+		},
+	}
+}
+
+func getMonitoringServicePorts(n *devopsV1.Nginx) []coreV1.ServicePort {
+	if !IsMonitoringEnabled(n) {
+		return nil
+	}
+	return []coreV1.ServicePort{
+		{
+			Name:       defaultMetricsName,
+			Protocol:   coreV1.ProtocolTCP,
+			TargetPort: intstr.FromString(defaultMetricsName),
+			Port:       getMetricsPort(n),
+		},
+	}
+}
+
+// NewServiceMonitor 构建抓取 nginx Service metrics 端口的 ServiceMonitor
+func NewServiceMonitor(n *devopsV1.Nginx) *unstructured.Unstructured {
+	endpoint := map[string]interface{}{
+		"port": defaultMetricsName,
+		"path": "/metrics",
+	}
+	serviceMonitorLabels := LabelsForNginx(n.Name)
+	if n.Spec.Monitoring != nil && n.Spec.Monitoring.ServiceMonitor != nil {
+		sm := n.Spec.Monitoring.ServiceMonitor
+		if sm.Interval != "" {
+			endpoint["interval"] = sm.Interval
+		}
+		serviceMonitorLabels = MergeMap(serviceMonitorLabels, sm.Labels)
+	}
+
+	matchLabels := map[string]interface{}{}
+	for k, v := range LabelsForNginx(n.Name) {
+		matchLabels[k] = v
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(ServiceMonitorGVK)
+	meta := GetObjectMeta(ServiceMonitor, n, serviceMonitorLabels, DefaultMap())
+	obj.SetName(meta.Name)
+	obj.SetNamespace(meta.Namespace)
+	obj.SetLabels(meta.Labels)
+	obj.SetOwnerReferences(meta.OwnerReferences)
+	obj.Object["spec"] = map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchLabels": matchLabels,
+		},
+		"endpoints": []interface{}{endpoint},
+	}
+	return obj
+}
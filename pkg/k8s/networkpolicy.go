@@ -0,0 +1,122 @@
+package k8s
+
+import (
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	coreV1 "k8s.io/api/core/v1"
+	networkingV1 "k8s.io/api/networking/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+	dnsPort            = 53
+)
+
+func IsNetworkPolicyEnabled(n *devopsV1.Nginx) bool {
+	return n.Spec.NetworkPolicy != nil && n.Spec.NetworkPolicy.Enabled
+}
+
+// getNetworkPolicyPorts 返回 Pod 模板中所有容器声明的端口(nginx 默认端口, exporter 端口等)
+func getNetworkPolicyPorts(n *devopsV1.Nginx) []networkingV1.NetworkPolicyPort {
+	// getContainerPorts 会补全 spec 中的默认端口, 使用副本避免修改 CRD 实例
+	template := newPodTemplateSpec(n.DeepCopy())
+
+	var ports []networkingV1.NetworkPolicyPort
+	for _, container := range template.Spec.Containers {
+		for _, port := range container.Ports {
+			protocol := port.Protocol
+			if protocol == "" {
+				protocol = coreV1.ProtocolTCP
+			}
+			number := intstr.FromInt(int(port.ContainerPort))
+			ports = append(ports, networkingV1.NetworkPolicyPort{Protocol: &protocol, Port: &number})
+		}
+	}
+	return ports
+}
+
+func getNetworkPolicyPeers(peers []devopsV1.NginxNetworkPolicyPeer) []networkingV1.NetworkPolicyPeer {
+	var result []networkingV1.NetworkPolicyPeer
+	for _, peer := range peers {
+		if peer.CIDR != "" {
+			result = append(result, networkingV1.NetworkPolicyPeer{
+				IPBlock: &networkingV1.IPBlock{CIDR: peer.CIDR, Except: peer.Except},
+			})
+			continue
+		}
+		result = append(result, networkingV1.NetworkPolicyPeer{
+			NamespaceSelector: peer.NamespaceSelector,
+			PodSelector:       peer.PodSelector,
+		})
+	}
+	return result
+}
+
+func getNetworkPolicyIngress(n *devopsV1.Nginx) []networkingV1.NetworkPolicyIngressRule {
+	policy := n.Spec.NetworkPolicy
+	peers := getNetworkPolicyPeers(policy.From)
+	if policy.IngressControllerNamespace != "" {
+		peers = append(peers, networkingV1.NetworkPolicyPeer{
+			NamespaceSelector: &metaV1.LabelSelector{
+				MatchLabels: map[string]string{namespaceNameLabel: policy.IngressControllerNamespace},
+			},
+		})
+	}
+	// 没有允许的来源时不生成规则, 拒绝所有入站流量
+	if len(peers) == 0 {
+		return nil
+	}
+	return []networkingV1.NetworkPolicyIngressRule{{From: peers, Ports: getNetworkPolicyPorts(n)}}
+}
+
+func getNetworkPolicyEgress(n *devopsV1.Nginx) []networkingV1.NetworkPolicyEgressRule {
+	upstreams := n.Spec.NetworkPolicy.Egress
+	if len(upstreams) == 0 {
+		return nil
+	}
+
+	udp, tcp := coreV1.ProtocolUDP, coreV1.ProtocolTCP
+	dns := intstr.FromInt(dnsPort)
+	rules := []networkingV1.NetworkPolicyEgressRule{
+		{Ports: []networkingV1.NetworkPolicyPort{{Protocol: &udp, Port: &dns}, {Protocol: &tcp, Port: &dns}}},
+	}
+	for _, upstream := range upstreams {
+		// 补全 API Server 的默认协议, 避免与集群中的对象比较时一直不相等
+		var ports []networkingV1.NetworkPolicyPort
+		for _, port := range upstream.Ports {
+			port := *port.DeepCopy()
+			if port.Protocol == nil {
+				port.Protocol = &tcp
+			}
+			ports = append(ports, port)
+		}
+		rules = append(rules, networkingV1.NetworkPolicyEgressRule{
+			To:    getNetworkPolicyPeers(upstream.To),
+			Ports: ports,
+		})
+	}
+	return rules
+}
+
+func getNetworkPolicyTypes(n *devopsV1.Nginx) []networkingV1.PolicyType {
+	types := []networkingV1.PolicyType{networkingV1.PolicyTypeIngress}
+	if len(n.Spec.NetworkPolicy.Egress) > 0 {
+		types = append(types, networkingV1.PolicyTypeEgress)
+	}
+	return types
+}
+
+// NewNetworkPolicy 构建选择 nginx Pod 的 NetworkPolicy, 调用前需确认 IsNetworkPolicyEnabled
+func NewNetworkPolicy(n *devopsV1.Nginx) *networkingV1.NetworkPolicy {
+	return &networkingV1.NetworkPolicy{
+		TypeMeta:   GetTypeMeta(NetworkPolicy),
+		ObjectMeta: GetObjectMeta(NetworkPolicy, n, LabelsForNginx(n.Name), DefaultMap()),
+		Spec: networkingV1.NetworkPolicySpec{
+			PodSelector: metaV1.LabelSelector{MatchLabels: LabelsForNginx(n.Name)},
+			Ingress:     getNetworkPolicyIngress(n),
+			Egress:      getNetworkPolicyEgress(n),
+			PolicyTypes: getNetworkPolicyTypes(n),
+		},
+	}
+}
@@ -0,0 +1,217 @@
+package k8s
+
+import (
+	"fmt"
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"regexp"
+	"strings"
+)
+
+const (
+	// operatorConfigMountPath 由 operator 生成的配置片段挂载目录
+	operatorConfigMountPath = "/etc/nginx/operator"
+	httpSnippetFileName     = "http.conf"
+	serverSnippetFileName   = "server.conf"
+	// defaultServerFileName 未自定义配置且需要 server 级别片段时, 替换镜像默认的 conf.d/default.conf
+	defaultServerFileName = "default-server.conf"
+)
+
+// GetHTTPSnippets 返回 operator 生成的 http 块级别的配置片段
+func GetHTTPSnippets(n *devopsV1.Nginx) []string {
+	var snippets []string
+	if IsMonitoringEnabled(n) {
+		snippets = append(snippets, getStubStatusSnippet(n))
+	}
+	if isBasicAuthEnforcedByNginx(n) {
+		snippets = append(snippets, getBasicAuthSnippet(n))
+	}
+	if isOIDCEnforcedByNginx(n) {
+		snippets = append(snippets, getOIDCHTTPSnippet(n))
+	}
+	if hasNginxLimits(n) {
+		snippets = append(snippets, getLimitsSnippet(n))
+	}
+	if IsWAFEnabled(n) {
+		snippets = append(snippets, getWAFSnippet())
+	}
+	if IsMaintenanceConfigured(n) {
+		snippets = append(snippets, getMaintenanceHTTPSnippet(n))
+	}
+	return snippets
+}
+
+// GetServerSnippets 返回 operator 生成的 server 块级别的配置片段, 例如 auth_request 需要的 location
+func GetServerSnippets(n *devopsV1.Nginx) []string {
+	var snippets []string
+	if isOIDCEnforcedByNginx(n) {
+		snippets = append(snippets, getOIDCServerSnippet())
+	}
+	if hasErrorPages(n) {
+		snippets = append(snippets, getErrorPagesServerSnippet(n))
+	}
+	return snippets
+}
+
+// GetServerSnippetInclude 返回在 server 块中引用生成配置的 include 指令,
+// 使用 ConfigMap 类型配置的用户需要在自己的每个 server 块中手动添加.
+func GetServerSnippetInclude() string {
+	return fmt.Sprintf("include %s/%s;", operatorConfigMountPath, serverSnippetFileName)
+}
+
+// getDefaultServerConfig 替换镜像默认的 server, 监听 http 端口并引用 server 级别的片段
+func getDefaultServerConfig(n *devopsV1.Nginx) string {
+	port := defaultHTTPPort
+	for _, p := range getContainerPorts(n.DeepCopy()) {
+		if p.Name == defaultHTTPPortName {
+			port = p.ContainerPort
+		}
+	}
+	include := ""
+	if len(GetServerSnippets(n)) > 0 {
+		include = "\n    " + GetServerSnippetInclude()
+	}
+	return fmt.Sprintf(`server {
+    listen %d;%s
+
+    location / {
+        root %s;
+        index index.html index.htm;
+    }
+}
+`, port, include, getWebRoot(n))
+}
+
+// GetHTTPSnippetInclude 返回在 http 块中引用生成配置的 include 指令,
+// 使用 ConfigMap 类型配置的用户需要在自己的 nginx.conf 中手动添加.
+func GetHTTPSnippetInclude() string {
+	return fmt.Sprintf("include %s/%s;", operatorConfigMountPath, httpSnippetFileName)
+}
+
+// RenderInlineConfig 在 Inline 配置的 http 块和其中每个 server 块开头插入生成配置的 include 指令,
+// 开启 WAF 时在开头加载 ModSecurity 模块
+func RenderInlineConfig(n *devopsV1.Nginx) string {
+	if n.Spec.Config == nil {
+		return ""
+	}
+	var httpInclude, serverInclude string
+	if len(GetHTTPSnippets(n)) > 0 {
+		httpInclude = GetHTTPSnippetInclude()
+	}
+	if len(GetServerSnippets(n)) > 0 {
+		serverInclude = GetServerSnippetInclude()
+	}
+	conf := n.Spec.Config.Value
+	if httpInclude != "" || serverInclude != "" {
+		conf = injectIncludes(conf, httpInclude, serverInclude)
+	}
+	return loadWAFModule(n, conf)
+}
+
+// hasDirective 配置中是否存在未被注释的指令, 指令各部分之间允许任意空白
+func hasDirective(conf, directive string) bool {
+	parts := strings.Fields(strings.TrimSuffix(directive, ";"))
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	pattern := `(?m)^[^#\n]*(^|[\s;{}])` + strings.Join(parts, `\s+`) + `\s*;`
+	return regexp.MustCompile(pattern).MatchString(conf)
+}
+
+// GetConfigMapConfigName 返回 ConfigMap 类型配置引用的 ConfigMap 名称, 其他类型返回空
+func GetConfigMapConfigName(n *devopsV1.Nginx) string {
+	if n.Spec.Config == nil || n.Spec.Config.Kind == devopsV1.ConfigKindInline {
+		return ""
+	}
+	return n.Spec.Config.Name
+}
+
+// GetMissingIncludes 返回 ConfigMap 类型配置中缺少的指令, 缺少时生成的配置片段不会生效,
+// 例如认证, 限流和维护模式被静默跳过. server 级别的 include 只检查是否出现, 不检查每个 server 块
+func GetMissingIncludes(n *devopsV1.Nginx, configMap *coreV1.ConfigMap) []string {
+	conf := configMap.Data[configFileName]
+	var missing []string
+	if IsWAFEnabled(n) && !hasDirective(conf, fmt.Sprintf("load_module %s;", wafModulePath)) {
+		missing = append(missing, fmt.Sprintf("load_module %s;", wafModulePath))
+	}
+	if len(GetHTTPSnippets(n)) > 0 && !hasDirective(conf, GetHTTPSnippetInclude()) {
+		missing = append(missing, GetHTTPSnippetInclude())
+	}
+	if len(GetServerSnippets(n)) > 0 && !hasDirective(conf, GetServerSnippetInclude()) {
+		missing = append(missing, GetServerSnippetInclude())
+	}
+	return missing
+}
+
+// injectIncludes 简单扫描 nginx 配置, 跳过注释和引号中的内容, 在顶层 http 块的 "{" 之后插入 httpInclude,
+// 在 http 块中 server 块的 "{" 之后插入 serverInclude, 为空时不插入
+func injectIncludes(conf, httpInclude, serverInclude string) string {
+	var out strings.Builder
+	var word strings.Builder
+	var statement []string
+	var quote rune
+	escaped := false
+	depth := 0
+	inHTTP := false
+	comment := false
+
+	flushWord := func() {
+		if word.Len() > 0 {
+			statement = append(statement, word.String())
+			word.Reset()
+		}
+	}
+
+	for _, c := range conf {
+		out.WriteRune(c)
+		switch {
+		case comment:
+			if c == '\n' {
+				comment = false
+			}
+		case quote != 0:
+			// 引号中的 \" 不结束字符串
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == quote:
+				quote = 0
+			}
+		case c == '#':
+			flushWord()
+			comment = true
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			flushWord()
+			if depth == 0 && len(statement) > 0 && statement[0] == "http" {
+				inHTTP = true
+				if httpInclude != "" {
+					out.WriteString("\n    " + httpInclude)
+				}
+			}
+			if depth == 1 && inHTTP && len(statement) > 0 && statement[0] == "server" && serverInclude != "" {
+				out.WriteString("\n        " + serverInclude)
+			}
+			depth++
+			statement = nil
+		case c == '}':
+			flushWord()
+			depth--
+			if depth == 0 {
+				inHTTP = false
+			}
+			statement = nil
+		case c == ';':
+			flushWord()
+			statement = nil
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flushWord()
+		default:
+			word.WriteRune(c)
+		}
+	}
+	return out.String()
+}
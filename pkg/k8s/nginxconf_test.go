@@ -0,0 +1,155 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	coreV1 "k8s.io/api/core/v1"
+)
+
+func TestInjectIncludes(t *testing.T) {
+	const (
+		httpInclude   = "include /etc/nginx/operator/http.conf;"
+		serverInclude = "include /etc/nginx/operator/server.conf;"
+	)
+
+	tests := []struct {
+		name                       string
+		conf                       string
+		httpInclude, serverInclude string
+		want                       string
+	}{
+		{
+			name:          "http and server blocks",
+			conf:          "events {}\nhttp {\n    server {\n        listen 80;\n    }\n}\n",
+			httpInclude:   httpInclude,
+			serverInclude: serverInclude,
+			want: "events {}\nhttp {\n    " + httpInclude + "\n    server {\n        " + serverInclude +
+				"\n        listen 80;\n    }\n}\n",
+		},
+		{
+			name:        "only http include",
+			conf:        "http { server { listen 80; } }",
+			httpInclude: httpInclude,
+			want:        "http {\n    " + httpInclude + " server { listen 80; } }",
+		},
+		{
+			name:          "braces and keywords in comments are ignored",
+			conf:          "# http {\nhttp { # server {\n}\n",
+			httpInclude:   httpInclude,
+			serverInclude: serverInclude,
+			want:          "# http {\nhttp {\n    " + httpInclude + " # server {\n}\n",
+		},
+		{
+			name:          "braces in quoted strings are ignored",
+			conf:          "http { log_format main '{\"a\":\"$uri\"}'; server { return 200 \"server { \\\" }\"; } }",
+			httpInclude:   httpInclude,
+			serverInclude: serverInclude,
+			want: "http {\n    " + httpInclude + " log_format main '{\"a\":\"$uri\"}'; server {\n        " + serverInclude +
+				" return 200 \"server { \\\" }\"; } }",
+		},
+		{
+			name:          "nested blocks are not treated as server blocks",
+			conf:          "http { upstream server { server 127.0.0.1; } server { location / { if ($a) { } } } map $a $b { server 1; } }",
+			httpInclude:   httpInclude,
+			serverInclude: serverInclude,
+			want: "http {\n    " + httpInclude + " upstream server { server 127.0.0.1; } server {\n        " + serverInclude +
+				" location / { if ($a) { } } } map $a $b { server 1; } }",
+		},
+		{
+			name:          "server outside http is not modified",
+			conf:          "stream { server { listen 53 udp; } }",
+			httpInclude:   httpInclude,
+			serverInclude: serverInclude,
+			want:          "stream { server { listen 53 udp; } }",
+		},
+		{
+			name:          "config without http block is unchanged",
+			conf:          "worker_processes 1;\nevents { worker_connections 1024; }\n",
+			httpInclude:   httpInclude,
+			serverInclude: serverInclude,
+			want:          "worker_processes 1;\nevents { worker_connections 1024; }\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := injectIncludes(tt.conf, tt.httpInclude, tt.serverInclude); got != tt.want {
+				t.Errorf("injectIncludes() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMissingIncludes(t *testing.T) {
+	const (
+		httpInclude   = "include /etc/nginx/operator/http.conf;"
+		serverInclude = "include /etc/nginx/operator/server.conf;"
+		loadModule    = "load_module modules/ngx_http_modsecurity_module.so;"
+	)
+	rateLimited := func(n *devopsV1.Nginx) {
+		n.Spec.RateLimits = []devopsV1.NginxRateLimit{{Name: "all", Rate: "10r/s"}}
+	}
+	maintenance := func(n *devopsV1.Nginx) {
+		n.Spec.Maintenance = &devopsV1.NginxMaintenance{}
+	}
+	waf := func(n *devopsV1.Nginx) {
+		n.Spec.WAF = &devopsV1.NginxWAF{}
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(n *devopsV1.Nginx)
+		conf   string
+		want   []string
+	}{
+		{
+			name: "nothing generated",
+			conf: "http { server { listen 80; } }",
+		},
+		{
+			name:   "http include present",
+			mutate: rateLimited,
+			conf:   "http {\n    include   /etc/nginx/operator/http.conf ;\n    server { listen 80; }\n}\n",
+		},
+		{
+			name:   "http include missing",
+			mutate: rateLimited,
+			conf:   "http { server { listen 80; } }",
+			want:   []string{httpInclude},
+		},
+		{
+			name:   "commented include does not count",
+			mutate: rateLimited,
+			conf:   "http {\n    # include /etc/nginx/operator/http.conf;\n}\n",
+			want:   []string{httpInclude},
+		},
+		{
+			name:   "server include missing",
+			mutate: maintenance,
+			conf:   "http { " + httpInclude + " server { listen 80; } }",
+			want:   []string{serverInclude},
+		},
+		{
+			name:   "waf needs the module",
+			mutate: waf,
+			conf:   "events {}\nhttp { " + httpInclude + " }",
+			want:   []string{loadModule},
+		},
+		{
+			name:   "waf with everything missing",
+			mutate: func(n *devopsV1.Nginx) { waf(n); maintenance(n) },
+			conf:   "http { server { listen 80; } }",
+			want:   []string{loadModule, httpInclude, serverInclude},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newLimitsTestNginx(tt.mutate)
+			configMap := &coreV1.ConfigMap{Data: map[string]string{"nginx.conf": tt.conf}}
+			if got := GetMissingIncludes(n, configMap); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetMissingIncludes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package k8s
+
+import (
+	"fmt"
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	"github.com/tomoncle/k8s-operator-nginx/pkg/k8s/ingressprofile"
+	coreV1 "k8s.io/api/core/v1"
+	networkingV1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultOAuth2ProxyImage  = "quay.io/oauth2-proxy/oauth2-proxy:v7.5.1"
+	oauth2ProxyContainerName = "oauth2-proxy"
+	oauth2ProxyPort          = int32(4180)
+	// OAuth2ProxyPortName 在 Ingress 上认证时, Service 和 Ingress 通过该端口访问 oauth2-proxy
+	OAuth2ProxyPortName      = "oauth2-proxy"
+	oauth2ProxyClientSecret  = "client-secret"
+	oauth2ProxyCookieSecret  = "cookie-secret"
+	oauth2ProxyAuthPath      = ingressprofile.OAuth2ProxyPathPrefix + "/auth"
+	oauth2ProxySignInPath    = ingressprofile.OAuth2ProxyPathPrefix + "/sign_in"
+	oidcSkipVariable         = "$nginx_operator_oidc_skip"
+	oauth2ProxyServerSnippet = `auth_request %[1]s;
+error_page 401 = %[2]s;
+
+location %[3]s/ {
+    auth_request off;
+    proxy_pass http://127.0.0.1:%[4]d;
+    proxy_set_header Host $host;
+    proxy_set_header X-Real-IP $remote_addr;
+    proxy_set_header X-Forwarded-Proto $scheme;
+    proxy_set_header X-Auth-Request-Redirect $request_uri;
+}
+
+location = %[1]s {
+    internal;
+    auth_request off;
+    if (%[5]s) {
+        return 204;
+    }
+    proxy_pass http://127.0.0.1:%[4]d;
+    proxy_set_header Host $host;
+    proxy_set_header X-Forwarded-Proto $scheme;
+    proxy_set_header Content-Length "";
+    proxy_pass_request_body off;
+}
+`
+)
+
+func IsOIDCEnabled(n *devopsV1.Nginx) bool {
+	return n.Spec.Auth != nil && n.Spec.Auth.OIDC != nil
+}
+
+// isOIDCEnforcedByNginx 未指定 enforcedBy 时由 nginx 通过 auth_request 认证
+func isOIDCEnforcedByNginx(n *devopsV1.Nginx) bool {
+	return IsOIDCEnabled(n) && n.Spec.Auth.OIDC.EnforcedBy != devopsV1.EnforcementIngress
+}
+
+func getOAuth2ProxyArgs(n *devopsV1.Nginx) []string {
+	oidc := n.Spec.Auth.OIDC
+	// 在 nginx 中认证时只有 nginx 访问 oauth2-proxy, 只监听本地地址
+	address := "127.0.0.1"
+	if !isOIDCEnforcedByNginx(n) {
+		address = "0.0.0.0"
+	}
+	args := []string{
+		"--provider=oidc",
+		"--oidc-issuer-url=" + oidc.IssuerURL,
+		"--client-id=" + oidc.ClientID,
+		fmt.Sprintf("--http-address=%s:%d", address, oauth2ProxyPort),
+		// 只做认证, 不代理上游
+		"--upstream=static://202",
+		"--reverse-proxy=true",
+		"--set-xauthrequest=true",
+		"--skip-provider-button=true",
+	}
+	emailDomains := oidc.EmailDomains
+	if len(emailDomains) == 0 {
+		emailDomains = []string{"*"}
+	}
+	for _, domain := range emailDomains {
+		args = append(args, "--email-domain="+domain)
+	}
+	if len(oidc.Groups) > 0 {
+		args = append(args, "--scope=openid email profile groups")
+		for _, group := range oidc.Groups {
+			args = append(args, "--allowed-group="+group)
+		}
+	}
+	return args
+}
+
+func newOAuth2ProxySecretEnv(name, secretName, key string) coreV1.EnvVar {
+	return coreV1.EnvVar{
+		Name: name,
+		ValueFrom: &coreV1.EnvVarSource{SecretKeyRef: &coreV1.SecretKeySelector{
+			LocalObjectReference: coreV1.LocalObjectReference{Name: secretName},
+			Key:                  key,
+		}},
+	}
+}
+
+// setOIDC 在 nginx Pod 中运行 oauth2-proxy sidecar
+func setOIDC(n *devopsV1.Nginx, template *coreV1.PodTemplateSpec) {
+	if !IsOIDCEnabled(n) {
+		return
+	}
+	oidc := n.Spec.Auth.OIDC
+	container := coreV1.Container{
+		Name:      oauth2ProxyContainerName,
+		Image:     NewDefaultStringUtils(oidc.Image, defaultOAuth2ProxyImage).ValueOrDefault(),
+		Args:      getOAuth2ProxyArgs(n),
+		Resources: oidc.Resources,
+		Env: []coreV1.EnvVar{
+			newOAuth2ProxySecretEnv("OAUTH2_PROXY_CLIENT_SECRET", oidc.ClientSecretName, oauth2ProxyClientSecret),
+			newOAuth2ProxySecretEnv("OAUTH2_PROXY_COOKIE_SECRET", oidc.ClientSecretName, oauth2ProxyCookieSecret),
+		},
+		ReadinessProbe: &coreV1.Probe{
+			ProbeHandler: coreV1.ProbeHandler{HTTPGet: &coreV1.HTTPGetAction{
+				Path: "/ping", Port: intstr.FromInt(int(oauth2ProxyPort)),
+			}},
+		},
+	}
+	if !isOIDCEnforcedByNginx(n) {
+		container.Ports = []coreV1.ContainerPort{makeContainerPort(OAuth2ProxyPortName, oauth2ProxyPort)}
+	} else {
+		// 只监听本地地址时 kubelet 无法访问, 不配置检查
+		container.ReadinessProbe = nil
+	}
+	if IsUnprivileged(n) {
+		container.SecurityContext = getRestrictedSecurityContext(nil)
+	}
+	template.Spec.Containers = append(template.Spec.Containers, container)
+}
+
+// getOIDCHTTPSnippet 按原始请求的 $request_uri 决定是否跳过认证, auth_request 子请求中 $uri 已经变为认证地址
+func getOIDCHTTPSnippet(n *devopsV1.Nginx) string {
+	oidc := n.Spec.Auth.OIDC
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "map $request_uri %s {\n", oidcSkipVariable)
+	if len(oidc.Paths) == 0 {
+		b.WriteString("    default 0;\n")
+	} else {
+		b.WriteString("    default 1;\n")
+	}
+	// 按顺序匹配正则, 健康检查路径在前
+	for _, path := range getHealthCheckPaths(n) {
+		fmt.Fprintf(&b, "    %s 1;\n", quoteNginxString(`~^`+regexp.QuoteMeta(path)+`(\?|$)`))
+	}
+	for _, path := range oidc.Paths {
+		fmt.Fprintf(&b, "    %s 0;\n", quoteNginxString("~^"+regexp.QuoteMeta(path)))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// getOIDCServerSnippet auth_request 需要在 server 块中声明转发到 oauth2-proxy 的 location
+func getOIDCServerSnippet() string {
+	return fmt.Sprintf(oauth2ProxyServerSnippet, oauth2ProxyAuthPath, oauth2ProxySignInPath,
+		ingressprofile.OAuth2ProxyPathPrefix, oauth2ProxyPort, oidcSkipVariable)
+}
+
+// getOAuth2ProxyServicePorts 在 Ingress 上认证时, 主 Service 暴露 oauth2-proxy 端口
+func getOAuth2ProxyServicePorts(n *devopsV1.Nginx) []coreV1.ServicePort {
+	if ingressprofile.IngressOIDCAuth(n) == nil {
+		return nil
+	}
+	return []coreV1.ServicePort{
+		{
+			Name:       OAuth2ProxyPortName,
+			Protocol:   coreV1.ProtocolTCP,
+			Port:       oauth2ProxyPort,
+			TargetPort: intstr.FromString(OAuth2ProxyPortName),
+		},
+	}
+}
+
+// NewOAuth2ProxyIngress 登录回调路径转发到 oauth2-proxy, 需要使用单独的 Ingress, 否则会被认证注解拦截
+func NewOAuth2ProxyIngress(n *devopsV1.Nginx) *networkingV1.Ingress {
+	pathType := networkingV1.PathTypePrefix
+	hosts := []string{}
+	for _, t := range n.Spec.TLS {
+		hosts = append(hosts, t.Hosts...)
+	}
+	if len(hosts) == 0 {
+		hosts = []string{""}
+	}
+
+	var rules []networkingV1.IngressRule
+	for _, host := range hosts {
+		rules = append(rules, networkingV1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingV1.IngressRuleValue{HTTP: &networkingV1.HTTPIngressRuleValue{
+				Paths: []networkingV1.HTTPIngressPath{{
+					Path:     ingressprofile.OAuth2ProxyPathPrefix,
+					PathType: &pathType,
+					Backend: networkingV1.IngressBackend{Service: &networkingV1.IngressServiceBackend{
+						Name: GetServiceName(n, GetPrimaryService(n).NameSuffix),
+						Port: networkingV1.ServiceBackendPort{Name: OAuth2ProxyPortName},
+					}},
+				}},
+			}},
+		})
+	}
+	return &networkingV1.Ingress{
+		TypeMeta:   GetTypeMeta(OAuth2ProxyIngress),
+		ObjectMeta: GetObjectMeta(OAuth2ProxyIngress, n, GetIngressLabels(n), n.Spec.Ingress.Annotations),
+		Spec: networkingV1.IngressSpec{
+			IngressClassName: GetIngressClassName(n),
+			Rules:            rules,
+			TLS:              getIngressTLS(n),
+		},
+	}
+}
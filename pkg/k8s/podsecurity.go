@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	coreV1 "k8s.io/api/core/v1"
+	psaApi "k8s.io/pod-security-admission/api"
+	psaPolicy "k8s.io/pod-security-admission/policy"
+)
+
+// podSecurityEvaluator 使用与 Pod Security Admission 相同的检查项
+var podSecurityEvaluator = func() psaPolicy.Evaluator {
+	evaluator, err := psaPolicy.NewEvaluator(psaPolicy.DefaultChecks())
+	if err != nil {
+		panic(err)
+	}
+	return evaluator
+}()
+
+// PodSecurityResult 是 Pod 模板在命名空间 enforce 级别下的检查结果
+type PodSecurityResult struct {
+	// Level 命名空间 pod-security.kubernetes.io/enforce 标签对应的级别, 未设置时为 privileged
+	Level string
+	// Version 命名空间 pod-security.kubernetes.io/enforce-version 标签对应的版本
+	Version string
+	// Allowed 是否满足 enforce 级别
+	Allowed bool
+	// Violations 不满足的检查项, 例如 "allowPrivilegeEscalation != false (container "nginx" must set ...)"
+	Violations []string
+}
+
+// GetPodTemplate 返回工作负载使用的 Pod 模板, 不修改 CRD 实例
+func GetPodTemplate(n *devopsV1.Nginx) coreV1.PodTemplateSpec {
+	return newPodTemplateSpec(n.DeepCopy())
+}
+
+// CheckPodSecurity 按照命名空间标签声明的 Pod Security Standards 级别检查 Pod 模板,
+// 非法的标签值与 Pod Security Admission 一样按照 restricted 处理
+func CheckPodSecurity(namespaceLabels map[string]string, template coreV1.PodTemplateSpec) PodSecurityResult {
+	defaults := psaApi.Policy{
+		Enforce: psaApi.LevelVersion{Level: psaApi.LevelPrivileged, Version: psaApi.LatestVersion()},
+	}
+	policy, _ := psaApi.PolicyToEvaluate(namespaceLabels, defaults)
+
+	result := PodSecurityResult{
+		Level:   string(policy.Enforce.Level),
+		Version: policy.Enforce.Version.String(),
+		Allowed: true,
+	}
+	if policy.Enforce.Level == psaApi.LevelPrivileged {
+		return result
+	}
+
+	aggregate := psaPolicy.AggregateCheckResults(podSecurityEvaluator.EvaluatePod(policy.Enforce, &template.ObjectMeta, &template.Spec))
+	result.Allowed = aggregate.Allowed
+	for i, reason := range aggregate.ForbiddenReasons {
+		violation := reason
+		if detail := aggregate.ForbiddenDetails[i]; detail != "" {
+			violation += " (" + detail + ")"
+		}
+		result.Violations = append(result.Violations, violation)
+	}
+	return result
+}
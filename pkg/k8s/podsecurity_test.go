@@ -0,0 +1,133 @@
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPodSecurityTestNginx(mutate func(n *devopsV1.Nginx)) *devopsV1.Nginx {
+	n := &devopsV1.Nginx{
+		ObjectMeta: metaV1.ObjectMeta{Name: "nginx-sample", Namespace: "default"},
+		Spec:       devopsV1.NginxSpec{Image: "nginx:stable-alpine"},
+	}
+	if mutate != nil {
+		mutate(n)
+	}
+	return n
+}
+
+func enforce(level string) map[string]string {
+	return map[string]string{"pod-security.kubernetes.io/enforce": level}
+}
+
+func TestCheckPodSecurity(t *testing.T) {
+	privileged := true
+
+	tests := []struct {
+		name            string
+		namespaceLabels map[string]string
+		nginx           *devopsV1.Nginx
+		wantLevel       string
+		wantAllowed     bool
+		wantViolations  []string
+	}{
+		{
+			name:        "namespace without label is privileged",
+			nginx:       newPodSecurityTestNginx(nil),
+			wantLevel:   "privileged",
+			wantAllowed: true,
+		},
+		{
+			name:            "default nginx satisfies baseline",
+			namespaceLabels: enforce("baseline"),
+			nginx:           newPodSecurityTestNginx(nil),
+			wantLevel:       "baseline",
+			wantAllowed:     true,
+		},
+		{
+			name:            "default nginx violates restricted",
+			namespaceLabels: enforce("restricted"),
+			nginx:           newPodSecurityTestNginx(nil),
+			wantLevel:       "restricted",
+			wantViolations:  []string{"allowPrivilegeEscalation != false", "unrestricted capabilities", "runAsNonRoot != true", "seccompProfile"},
+		},
+		{
+			name:            "unprivileged nginx satisfies restricted",
+			namespaceLabels: enforce("restricted"),
+			nginx: newPodSecurityTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.PodTemplate.Unprivileged = true
+			}),
+			wantLevel:   "restricted",
+			wantAllowed: true,
+		},
+		{
+			name:            "unprivileged nginx with monitoring satisfies restricted",
+			namespaceLabels: enforce("restricted"),
+			nginx: newPodSecurityTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.PodTemplate.Unprivileged = true
+				n.Spec.Monitoring = &devopsV1.NginxMonitoring{Enabled: true}
+			}),
+			wantLevel:   "restricted",
+			wantAllowed: true,
+		},
+		{
+			name:            "host network violates baseline",
+			namespaceLabels: enforce("baseline"),
+			nginx: newPodSecurityTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.PodTemplate.HostNetwork = true
+			}),
+			wantLevel:      "baseline",
+			wantViolations: []string{"host namespaces"},
+		},
+		{
+			name:            "privileged container violates baseline",
+			namespaceLabels: enforce("baseline"),
+			nginx: newPodSecurityTestNginx(func(n *devopsV1.Nginx) {
+				n.Spec.PodTemplate.SecurityContext = &coreV1.SecurityContext{Privileged: &privileged}
+			}),
+			wantLevel:      "baseline",
+			wantViolations: []string{"privileged"},
+		},
+		{
+			name:            "invalid level is evaluated as restricted",
+			namespaceLabels: enforce("strict"),
+			nginx:           newPodSecurityTestNginx(nil),
+			wantLevel:       "restricted",
+			wantViolations:  []string{"runAsNonRoot != true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CheckPodSecurity(tt.namespaceLabels, GetPodTemplate(tt.nginx))
+
+			if result.Level != tt.wantLevel {
+				t.Errorf("level = %q, want %q", result.Level, tt.wantLevel)
+			}
+			if result.Allowed != tt.wantAllowed {
+				t.Errorf("allowed = %v, want %v (violations: %v)", result.Allowed, tt.wantAllowed, result.Violations)
+			}
+			if tt.wantAllowed && len(result.Violations) > 0 {
+				t.Errorf("unexpected violations: %v", result.Violations)
+			}
+			violations := strings.Join(result.Violations, "; ")
+			for _, want := range tt.wantViolations {
+				if !strings.Contains(violations, want) {
+					t.Errorf("violations %q do not mention %q", violations, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetPodTemplateDoesNotMutateSpec(t *testing.T) {
+	n := newPodSecurityTestNginx(nil)
+	GetPodTemplate(n)
+	if len(n.Spec.PodTemplate.Ports) != 0 {
+		t.Errorf("GetPodTemplate added ports to the spec: %v", n.Spec.PodTemplate.Ports)
+	}
+}
@@ -1,55 +1,90 @@
 package k8s
 
 import (
+	"fmt"
+
 	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
 	coreV1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-func GetServiceLabels(n *devopsV1.Nginx) map[string]string {
-	labels := map[string]string{}
+// DefaultServiceNameSuffix 默认 Service 的名称后缀, 与 spec.service 生成的 Service 名称一致
+const DefaultServiceNameSuffix = "service"
+
+// GetServices 返回需要创建的 Service 列表, 未配置 spec.services 时使用 spec.service 生成默认 Service
+func GetServices(n *devopsV1.Nginx) []devopsV1.NginxNamedService {
+	if len(n.Spec.Services) > 0 {
+		return n.Spec.Services
+	}
+	service := devopsV1.NginxNamedService{NameSuffix: DefaultServiceNameSuffix}
 	if n.Spec.Service != nil {
-		labels = n.Spec.Service.Labels
+		service.NginxService = *n.Spec.Service
 	}
-	return MergeMap(labels, LabelsForNginx(n.Name))
+	return []devopsV1.NginxNamedService{service}
 }
 
-func GetServiceSelector(n *devopsV1.Nginx) map[string]string {
-	selector := LabelsForNginx(n.Name)
-	if n.Spec.Service != nil {
-		if n.Spec.Service.UsePodSelector != nil && !*n.Spec.Service.UsePodSelector {
-			selector = nil
+// GetServiceName 返回指定后缀的 Service 名称
+func GetServiceName(n *devopsV1.Nginx, suffix string) string {
+	return fmt.Sprintf("%s-%s", n.Name, suffix)
+}
+
+// GetPrimaryService 返回 Ingress 和监控使用的 Service: 优先使用默认后缀, 否则为列表中的第一个
+func GetPrimaryService(n *devopsV1.Nginx) devopsV1.NginxNamedService {
+	services := GetServices(n)
+	for _, s := range services {
+		if s.NameSuffix == DefaultServiceNameSuffix {
+			return s
 		}
 	}
-	return selector
+	return services[0]
 }
 
-func GetServiceAnnotations(n *devopsV1.Nginx) map[string]string {
-	annotations := map[string]string{}
-	if n.Spec.Service != nil {
-		if n.Spec.Service.Annotations != nil {
-			annotations = n.Spec.Service.Annotations
-		}
+func isPrimaryService(n *devopsV1.Nginx, s devopsV1.NginxNamedService) bool {
+	return GetPrimaryService(n).NameSuffix == s.NameSuffix
+}
+
+func GetServiceLabels(n *devopsV1.Nginx, s devopsV1.NginxNamedService) map[string]string {
+	return MergeMap(MergeMap(DefaultMap(), s.Labels), LabelsForNginx(n.Name))
+}
+
+func GetServiceSelector(n *devopsV1.Nginx, s devopsV1.NginxNamedService) map[string]string {
+	if s.UsePodSelector != nil && !*s.UsePodSelector {
+		return nil
+	}
+	return LabelsForNginx(n.Name)
+}
+
+func GetServiceAnnotations(n *devopsV1.Nginx, s devopsV1.NginxNamedService) map[string]string {
+	annotations := MergeMap(DefaultMap(), s.Annotations)
+	// ingress features 需要的 Service 注解(例如 Traefik 的后端协议), 只设置到 Ingress 使用的 Service, 用户设置的注解优先
+	if !isPrimaryService(n, s) {
+		return annotations
+	}
+	if serviceAnnotations := translateIngressFeatures(n).ServiceAnnotations; len(serviceAnnotations) > 0 {
+		annotations = MergeMap(MergeMap(DefaultMap(), serviceAnnotations), annotations)
 	}
 	return annotations
 }
 
-func GetExternalTrafficPolicy(n *devopsV1.Nginx) coreV1.ServiceExternalTrafficPolicyType {
-	if n.Spec.Service == nil || n.Spec.Service.Type == coreV1.ServiceTypeClusterIP {
+func GetExternalTrafficPolicy(s devopsV1.NginxNamedService) coreV1.ServiceExternalTrafficPolicyType {
+	if s.Type == "" || s.Type == coreV1.ServiceTypeClusterIP {
 		return ""
 	}
-	var externalTrafficPolicy coreV1.ServiceExternalTrafficPolicyType
-	if n.Spec.Service != nil {
-		externalTrafficPolicy = n.Spec.Service.ExternalTrafficPolicy
-	}
-	return externalTrafficPolicy
+	return s.ExternalTrafficPolicy
 }
 
-func GetServiceType(n *devopsV1.Nginx) coreV1.ServiceType {
-	if n == nil || n.Spec.Service == nil {
+func GetServiceType(s devopsV1.NginxNamedService) coreV1.ServiceType {
+	if s.Type == "" {
 		return coreV1.ServiceTypeClusterIP
 	}
-	return n.Spec.Service.Type
+	return s.Type
+}
+
+func GetLoadBalancerIP(s devopsV1.NginxNamedService) string {
+	if s.Type != coreV1.ServiceTypeLoadBalancer {
+		return ""
+	}
+	return s.LoadBalancerIP
 }
 
 func GetServicePorts() []coreV1.ServicePort {
@@ -57,7 +92,7 @@ func GetServicePorts() []coreV1.ServicePort {
 		{
 			Name:       defaultHTTPPortName,
 			Protocol:   coreV1.ProtocolTCP,
-			TargetPort: intstr.FromInt(int(defaultHTTPPort)),
+			TargetPort: intstr.FromString(defaultHTTPPortName),
 			Port:       int32(80),
 		},
 		{
@@ -70,15 +105,37 @@ func GetServicePorts() []coreV1.ServicePort {
 	return ports
 }
 
-func NewService(n *devopsV1.Nginx) *coreV1.Service {
+// NewService 构建 spec.services 中的一个 Service, metrics 端口只添加到 Ingress 使用的 Service
+func NewService(n *devopsV1.Nginx, s devopsV1.NginxNamedService) *coreV1.Service {
+	ports := GetServicePorts()
+	if isPrimaryService(n, s) {
+		ports = append(ports, getMonitoringServicePorts(n)...)
+		ports = append(ports, getOAuth2ProxyServicePorts(n)...)
+	}
+	objectMeta := GetObjectMeta(Service, n, GetServiceLabels(n, s), GetServiceAnnotations(n, s))
+	objectMeta.Name = GetServiceName(n, s.NameSuffix)
 	return &coreV1.Service{
 		TypeMeta:   GetTypeMeta(Service),
-		ObjectMeta: GetObjectMeta(Service, n, GetServiceLabels(n), GetServiceAnnotations(n)),
+		ObjectMeta: objectMeta,
+		Spec: coreV1.ServiceSpec{
+			Ports:                 ports,
+			Selector:              GetServiceSelector(n, s),
+			Type:                  GetServiceType(s),
+			ExternalTrafficPolicy: GetExternalTrafficPolicy(s),
+			LoadBalancerIP:        GetLoadBalancerIP(s),
+		},
+	}
+}
+
+// NewHeadlessService 构建 StatefulSet 使用的 headless Service, 为每个 Pod 提供稳定的网络标识
+func NewHeadlessService(n *devopsV1.Nginx) *coreV1.Service {
+	return &coreV1.Service{
+		TypeMeta:   GetTypeMeta(HeadlessService),
+		ObjectMeta: GetObjectMeta(HeadlessService, n, LabelsForNginx(n.Name), DefaultMap()),
 		Spec: coreV1.ServiceSpec{
-			Ports:                 GetServicePorts(),
-			Selector:              GetServiceSelector(n),
-			Type:                  GetServiceType(n),
-			ExternalTrafficPolicy: GetExternalTrafficPolicy(n),
+			ClusterIP: coreV1.ClusterIPNone,
+			Ports:     GetServicePorts(),
+			Selector:  LabelsForNginx(n.Name),
 		},
 	}
 }
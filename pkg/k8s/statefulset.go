@@ -0,0 +1,66 @@
+package k8s
+
+import (
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const defaultCacheSize = "1Gi"
+
+func getCacheVolumeClaimTemplates(n *devopsV1.Nginx) []coreV1.PersistentVolumeClaim {
+	if n.Spec.Cache == nil {
+		return nil
+	}
+	claim := n.Spec.Cache.VolumeClaimTemplate
+
+	size := resource.MustParse(defaultCacheSize)
+	if claim.Size != nil {
+		size = *claim.Size
+	}
+	accessModes := claim.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = []coreV1.PersistentVolumeAccessMode{coreV1.ReadWriteOnce}
+	}
+
+	return []coreV1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name:   cacheVolumeName,
+				Labels: LabelsForNginx(n.Name),
+			},
+			Spec: coreV1.PersistentVolumeClaimSpec{
+				AccessModes:      accessModes,
+				StorageClassName: claim.StorageClassName,
+				Resources: coreV1.ResourceRequirements{
+					Requests: coreV1.ResourceList{
+						coreV1.ResourceStorage: size,
+					},
+				},
+			},
+		},
+	}
+}
+
+func NewStatefulSet(n *devopsV1.Nginx) (*appsV1.StatefulSet, error) {
+	statefulSet := appsV1.StatefulSet{
+		TypeMeta:   GetTypeMeta(StatefulSet),
+		ObjectMeta: GetObjectMeta(StatefulSet, n, LabelsForNginx(n.Name), getWorkloadAnnotations(n.Spec)),
+		Spec: appsV1.StatefulSetSpec{
+			Replicas:    getWorkloadReplicas(n),
+			ServiceName: GetObjectMeta(HeadlessService, n, nil, nil).Name,
+			// nginx 实例之间没有启动顺序依赖, 并行创建和删除 Pod
+			PodManagementPolicy: appsV1.ParallelPodManagement,
+			UpdateStrategy: appsV1.StatefulSetUpdateStrategy{
+				Type: appsV1.RollingUpdateStatefulSetStrategyType,
+			},
+			MinReadySeconds:      getMinReadySeconds(n),
+			Selector:             &metaV1.LabelSelector{MatchLabels: LabelsForNginx(n.Name)},
+			Template:             newPodTemplateSpec(n),
+			VolumeClaimTemplates: getCacheVolumeClaimTemplates(n),
+		},
+	}
+	return &statefulSet, nil
+}
@@ -0,0 +1,104 @@
+package k8s
+
+import (
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	coreV1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultUnprivilegedImage     = "nginxinc/nginx-unprivileged:stable-alpine"
+	defaultUnprivilegedHTTPPort  = int32(8080)
+	defaultUnprivilegedHTTPSPort = int32(8443)
+	unprivilegedTmpVolumeName    = "nginx-tmp"
+	// unprivilegedCacheVolumeName 镜像默认的缓存目录, 不能与 spec.cache 的 nginx-cache 卷同名
+	unprivilegedCacheVolumeName = "nginx-var-cache"
+	unprivilegedTmpPath         = "/tmp"
+)
+
+func IsUnprivileged(n *devopsV1.Nginx) bool {
+	return n.Spec.PodTemplate.Unprivileged
+}
+
+func getImage(n *devopsV1.Nginx) string {
+	if IsWAFEnabled(n) {
+		return getWAFImage(n)
+	}
+	if IsUnprivileged(n) {
+		return NewDefaultStringUtils(n.Spec.Image, defaultUnprivilegedImage).ValueOrDefault()
+	}
+	return NewDefaultStringUtils(n.Spec.Image, defaultImage).ValueOrDefault()
+}
+
+// getRestrictedSecurityContext 在用户配置的基础上补全 restricted Pod Security Standard 要求的字段
+func getRestrictedSecurityContext(securityContext *coreV1.SecurityContext) *coreV1.SecurityContext {
+	if securityContext == nil {
+		securityContext = &coreV1.SecurityContext{}
+	} else {
+		securityContext = securityContext.DeepCopy()
+	}
+	if securityContext.RunAsNonRoot == nil {
+		securityContext.RunAsNonRoot = func(b bool) *bool { return &b }(true)
+	}
+	if securityContext.AllowPrivilegeEscalation == nil {
+		securityContext.AllowPrivilegeEscalation = func(b bool) *bool { return &b }(false)
+	}
+	if securityContext.ReadOnlyRootFilesystem == nil {
+		securityContext.ReadOnlyRootFilesystem = func(b bool) *bool { return &b }(true)
+	}
+	if securityContext.SeccompProfile == nil {
+		securityContext.SeccompProfile = &coreV1.SeccompProfile{Type: coreV1.SeccompProfileTypeRuntimeDefault}
+	}
+	if securityContext.Capabilities == nil {
+		securityContext.Capabilities = &coreV1.Capabilities{}
+	}
+	securityContext.Capabilities.Drop = []coreV1.Capability{"ALL"}
+	return securityContext
+}
+
+// getPodSecurityContext 非 root 模式下, Pod 级别同样要求非 root 用户和 RuntimeDefault seccomp profile
+func getPodSecurityContext(n *devopsV1.Nginx) *coreV1.PodSecurityContext {
+	securityContext := n.Spec.PodTemplate.PodSecurityContext
+	if !IsUnprivileged(n) {
+		return securityContext
+	}
+	if securityContext == nil {
+		securityContext = &coreV1.PodSecurityContext{}
+	} else {
+		securityContext = securityContext.DeepCopy()
+	}
+	if securityContext.RunAsNonRoot == nil {
+		securityContext.RunAsNonRoot = func(b bool) *bool { return &b }(true)
+	}
+	if securityContext.SeccompProfile == nil {
+		securityContext.SeccompProfile = &coreV1.SeccompProfile{Type: coreV1.SeccompProfileTypeRuntimeDefault}
+	}
+	return securityContext
+}
+
+// setUnprivilegedVolumes 只读根文件系统下, nginx 需要可写的缓存目录和 /tmp(pid 文件, 临时文件)
+func setUnprivilegedVolumes(n *devopsV1.Nginx, template *coreV1.PodTemplateSpec) {
+	if !IsUnprivileged(n) {
+		return
+	}
+
+	container := &template.Spec.Containers[0]
+	mounted := map[string]bool{}
+	for _, mount := range container.VolumeMounts {
+		mounted[mount.MountPath] = true
+	}
+
+	for _, volume := range []struct{ name, path string }{
+		{unprivilegedCacheVolumeName, defaultCacheMountPath},
+		{unprivilegedTmpVolumeName, unprivilegedTmpPath},
+	} {
+		// 已经配置了缓存卷(或用户挂载了同一目录)时不再重复挂载
+		if mounted[volume.path] {
+			continue
+		}
+		container.VolumeMounts = append(container.VolumeMounts, coreV1.VolumeMount{Name: volume.name, MountPath: volume.path})
+		template.Spec.Volumes = append(template.Spec.Volumes, coreV1.Volume{
+			Name:         volume.name,
+			VolumeSource: coreV1.VolumeSource{EmptyDir: &coreV1.EmptyDirVolumeSource{}},
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+)
+
+func TestSetUnprivilegedVolumes(t *testing.T) {
+	unprivileged := func(n *devopsV1.Nginx) { n.Spec.PodTemplate.Unprivileged = true }
+
+	tests := []struct {
+		name    string
+		nginx   *devopsV1.Nginx
+		volumes []string
+		mounts  map[string]string
+	}{
+		{
+			name:    "without cache",
+			nginx:   newPodSecurityTestNginx(unprivileged),
+			volumes: []string{"nginx-var-cache", "nginx-tmp"},
+			mounts:  map[string]string{"/var/cache/nginx": "nginx-var-cache", "/tmp": "nginx-tmp"},
+		},
+		{
+			name: "cache on the default path is reused",
+			nginx: newPodSecurityTestNginx(func(n *devopsV1.Nginx) {
+				unprivileged(n)
+				n.Spec.Cache = &devopsV1.NginxCache{}
+			}),
+			volumes: []string{"nginx-cache", "nginx-tmp"},
+			mounts:  map[string]string{"/var/cache/nginx": "nginx-cache", "/tmp": "nginx-tmp"},
+		},
+		{
+			name: "cache on a custom path",
+			nginx: newPodSecurityTestNginx(func(n *devopsV1.Nginx) {
+				unprivileged(n)
+				n.Spec.Cache = &devopsV1.NginxCache{Path: "/data/cache"}
+			}),
+			volumes: []string{"nginx-cache", "nginx-var-cache", "nginx-tmp"},
+			mounts: map[string]string{
+				"/data/cache": "nginx-cache", "/var/cache/nginx": "nginx-var-cache", "/tmp": "nginx-tmp",
+			},
+		},
+		{
+			name: "statefulset cache on a custom path uses the claim template",
+			nginx: newPodSecurityTestNginx(func(n *devopsV1.Nginx) {
+				unprivileged(n)
+				n.Spec.WorkloadKind = devopsV1.WorkloadKindStatefulSet
+				n.Spec.Cache = &devopsV1.NginxCache{Path: "/data/cache"}
+			}),
+			volumes: []string{"nginx-var-cache", "nginx-tmp"},
+			mounts: map[string]string{
+				"/data/cache": "nginx-cache", "/var/cache/nginx": "nginx-var-cache", "/tmp": "nginx-tmp",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := GetPodTemplate(tt.nginx)
+
+			var volumes []string
+			for _, volume := range template.Spec.Volumes {
+				if volume.EmptyDir != nil {
+					volumes = append(volumes, volume.Name)
+				}
+			}
+			if !reflect.DeepEqual(volumes, tt.volumes) {
+				t.Errorf("emptyDir volumes = %q, want %q", volumes, tt.volumes)
+			}
+			names := map[string]bool{}
+			for _, volume := range template.Spec.Volumes {
+				if names[volume.Name] {
+					t.Errorf("duplicate volume %q", volume.Name)
+				}
+				names[volume.Name] = true
+			}
+
+			for path, name := range tt.mounts {
+				found := false
+				for _, mount := range template.Spec.Containers[0].VolumeMounts {
+					if mount.MountPath == path {
+						found = mount.Name == name
+					}
+				}
+				if !found {
+					t.Errorf("%s is not mounted from volume %q", path, name)
+				}
+			}
+		})
+	}
+}
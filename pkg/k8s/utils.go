@@ -3,6 +3,7 @@ package k8s
 import (
 	"fmt"
 	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	"github.com/tomoncle/k8s-operator-nginx/pkg/k8s/ingressprofile"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"strings"
@@ -11,9 +12,20 @@ import (
 type ResourceType string
 
 const (
-	Deployment = ResourceType("deployment")
-	Service    = ResourceType("service")
-	Ingress    = ResourceType("ingress")
+	Deployment  = ResourceType("deployment")
+	DaemonSet   = ResourceType("daemonset")
+	StatefulSet = ResourceType("statefulset")
+	Service     = ResourceType("service")
+	Ingress     = ResourceType("ingress")
+
+	HeadlessService         = ResourceType("headless-service")
+	HorizontalPodAutoscaler = ResourceType("horizontalpodautoscaler")
+	GeneratedConfig         = ResourceType("generated-config")
+	ServiceMonitor          = ResourceType("servicemonitor")
+	NetworkPolicy           = ResourceType("networkpolicy")
+	BasicAuthSecret         = ResourceType("basic-auth-secret")
+	OAuth2ProxyIngress      = ResourceType("oauth2-proxy-ingress")
+	MaintenanceConfig       = ResourceType("maintenance-config")
 )
 
 func DefaultMap() map[string]string {
@@ -37,6 +49,14 @@ func LabelsForNginx(name string) map[string]string {
 	}
 }
 
+// GetWorkloadKind 返回 nginx 使用的工作负载类型, 默认为 Deployment
+func GetWorkloadKind(n *devopsV1.Nginx) devopsV1.WorkloadKind {
+	if n.Spec.WorkloadKind == "" {
+		return devopsV1.WorkloadKindDeployment
+	}
+	return n.Spec.WorkloadKind
+}
+
 func MakeKeyForNginx(key string) string {
 	return fmt.Sprintf("%s/%s", devopsV1.GroupVersion.Group, key)
 }
@@ -45,10 +65,24 @@ func GetTypeMeta(res ResourceType) metaV1.TypeMeta {
 	switch res {
 	case Deployment:
 		return metaV1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"}
-	case Service:
+	case DaemonSet:
+		return metaV1.TypeMeta{Kind: "DaemonSet", APIVersion: "apps/v1"}
+	case StatefulSet:
+		return metaV1.TypeMeta{Kind: "StatefulSet", APIVersion: "apps/v1"}
+	case Service, HeadlessService:
 		return metaV1.TypeMeta{Kind: "Service", APIVersion: "v1"}
-	case Ingress:
+	case Ingress, OAuth2ProxyIngress:
 		return metaV1.TypeMeta{Kind: "Ingress", APIVersion: "networking.k8s.io/v1"}
+	case HorizontalPodAutoscaler:
+		return metaV1.TypeMeta{Kind: "HorizontalPodAutoscaler", APIVersion: "autoscaling/v2"}
+	case GeneratedConfig, MaintenanceConfig:
+		return metaV1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"}
+	case NetworkPolicy:
+		return metaV1.TypeMeta{Kind: "NetworkPolicy", APIVersion: "networking.k8s.io/v1"}
+	case BasicAuthSecret:
+		return metaV1.TypeMeta{Kind: "Secret", APIVersion: "v1"}
+	case ServiceMonitor:
+		return metaV1.TypeMeta{Kind: ServiceMonitorGVK.Kind, APIVersion: ServiceMonitorGVK.GroupVersion().String()}
 	default:
 		var typeMeta metaV1.TypeMeta
 		return typeMeta
@@ -58,12 +92,29 @@ func GetTypeMeta(res ResourceType) metaV1.TypeMeta {
 func GetObjectMeta(res ResourceType, n *devopsV1.Nginx, labels, annotations map[string]string) metaV1.ObjectMeta {
 	var name string
 	switch res {
-	case Deployment:
+	case Deployment, DaemonSet, StatefulSet:
 		name = n.Name
 	case Service:
 		name = fmt.Sprintf("%s-service", n.Name)
+	case HeadlessService:
+		name = fmt.Sprintf("%s-headless", n.Name)
 	case Ingress:
 		name = fmt.Sprintf("%s-ingress", n.Name)
+	case HorizontalPodAutoscaler:
+		name = fmt.Sprintf("%s-hpa", n.Name)
+	case GeneratedConfig:
+		name = fmt.Sprintf("%s-generated-config", n.Name)
+	case ServiceMonitor:
+		name = fmt.Sprintf("%s-monitor", n.Name)
+	case NetworkPolicy:
+		name = fmt.Sprintf("%s-network-policy", n.Name)
+	case BasicAuthSecret:
+		// Ingress 注解和 Traefik Middleware 也引用该名称
+		name = ingressprofile.BasicAuthSecretName(n)
+	case OAuth2ProxyIngress:
+		name = fmt.Sprintf("%s-oauth2-ingress", n.Name)
+	case MaintenanceConfig:
+		name = fmt.Sprintf("%s-maintenance", n.Name)
 	}
 	return metaV1.ObjectMeta{
 		Name:        name,
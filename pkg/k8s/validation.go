@@ -0,0 +1,134 @@
+package k8s
+
+import (
+	"fmt"
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+)
+
+// Validate 依次执行所有 spec 校验, 返回第一个错误
+func Validate(n *devopsV1.Nginx) error {
+	for _, validate := range []func(*devopsV1.Nginx) error{ValidateConfig, ValidateServices, ValidateNetworkPolicy, ValidatePodTemplate, ValidateAutoscaling, ValidateProbes, ValidateContent, ValidateAuth, ValidateLimits, ValidateWAF, ValidateErrorPages} {
+		if err := validate(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateConfig 校验 spec.config 的引用是否完整, 避免生成挂载失败的 Pod
+func ValidateConfig(n *devopsV1.Nginx) error {
+	conf := n.Spec.Config
+	if conf == nil {
+		return nil
+	}
+	if conf.Name != "" && conf.Value != "" {
+		return fmt.Errorf("spec.config: name and value are mutually exclusive")
+	}
+	switch conf.Kind {
+	case devopsV1.ConfigKindConfigMap, "":
+		if conf.Name == "" {
+			return fmt.Errorf("spec.config: name is required when kind is %q", devopsV1.ConfigKindConfigMap)
+		}
+	case devopsV1.ConfigKindInline:
+		if conf.Value == "" {
+			return fmt.Errorf("spec.config: value is required when kind is %q", devopsV1.ConfigKindInline)
+		}
+	default:
+		return fmt.Errorf("spec.config: unsupported kind %q", conf.Kind)
+	}
+	return nil
+}
+
+// ValidateServices 校验 spec.service 与 spec.services 的组合以及名称后缀, 避免 Service 名称冲突
+func ValidateServices(n *devopsV1.Nginx) error {
+	if n.Spec.Service != nil && len(n.Spec.Services) > 0 {
+		return fmt.Errorf("spec.service and spec.services are mutually exclusive")
+	}
+	suffixes := map[string]bool{}
+	for i, s := range n.Spec.Services {
+		if s.NameSuffix == "" {
+			return fmt.Errorf("spec.services[%d].nameSuffix is required", i)
+		}
+		if s.NameSuffix == "headless" {
+			return fmt.Errorf("spec.services[%d].nameSuffix: %q is reserved for the StatefulSet headless Service", i, s.NameSuffix)
+		}
+		if suffixes[s.NameSuffix] {
+			return fmt.Errorf("spec.services[%d].nameSuffix: duplicate value %q", i, s.NameSuffix)
+		}
+		suffixes[s.NameSuffix] = true
+	}
+	return nil
+}
+
+// ValidateNetworkPolicy 校验网络策略对端, CIDR 与 selector 互斥且不能为空
+func ValidateNetworkPolicy(n *devopsV1.Nginx) error {
+	policy := n.Spec.NetworkPolicy
+	if policy == nil {
+		return nil
+	}
+	validatePeers := func(path string, peers []devopsV1.NginxNetworkPolicyPeer) error {
+		for i, peer := range peers {
+			hasSelector := peer.NamespaceSelector != nil || peer.PodSelector != nil
+			if peer.CIDR != "" && hasSelector {
+				return fmt.Errorf("%s[%d]: cidr and selectors are mutually exclusive", path, i)
+			}
+			if peer.CIDR == "" && !hasSelector {
+				return fmt.Errorf("%s[%d]: one of cidr, namespaceSelector or podSelector is required", path, i)
+			}
+			if peer.CIDR == "" && len(peer.Except) > 0 {
+				return fmt.Errorf("%s[%d]: except requires cidr", path, i)
+			}
+		}
+		return nil
+	}
+	if err := validatePeers("spec.networkPolicy.from", policy.From); err != nil {
+		return err
+	}
+	for i, upstream := range policy.Egress {
+		if err := validatePeers(fmt.Sprintf("spec.networkPolicy.egress[%d].to", i), upstream.To); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidatePodTemplate 校验 Pod 模板中相互冲突的配置
+func ValidatePodTemplate(n *devopsV1.Nginx) error {
+	podTemplate := n.Spec.PodTemplate
+	if IsGracefulShutdownEnabled(n) && podTemplate.Lifecycle != nil && podTemplate.Lifecycle.PreStop != nil {
+		return fmt.Errorf("spec.podTemplate: lifecycle.preStop and gracefulShutdown are mutually exclusive")
+	}
+	if podTemplate.Unprivileged {
+		for _, port := range podTemplate.Ports {
+			if port.ContainerPort < 1024 {
+				return fmt.Errorf("spec.podTemplate.ports: port %d of %q cannot be bound by an unprivileged nginx, use a port >= 1024", port.ContainerPort, port.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateProbes 校验健康检查配置, liveness 和 startup 的 successThreshold 只能为 1
+func ValidateProbes(n *devopsV1.Nginx) error {
+	probes := getProbes(n)
+	for _, item := range []struct {
+		name  string
+		probe *devopsV1.NginxProbe
+	}{
+		{"readiness", probes.Readiness},
+		{"liveness", probes.Liveness},
+		{"startup", probes.Startup},
+	} {
+		name, probe := item.name, item.probe
+		if probe == nil {
+			continue
+		}
+		if len(probe.Command) > 0 && probe.Type != devopsV1.ProbeTypeExec {
+			return fmt.Errorf("spec.probes.%s: command requires type %q", name, devopsV1.ProbeTypeExec)
+		}
+		if name != "readiness" && probe.SuccessThreshold != nil && *probe.SuccessThreshold != 1 {
+			return fmt.Errorf("spec.probes.%s: successThreshold must be 1", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package k8s
+
+import (
+	"fmt"
+	devopsV1 "github.com/tomoncle/k8s-operator-nginx/api/v1"
+	coreV1 "k8s.io/api/core/v1"
+	"strings"
+)
+
+const (
+	defaultWAFImage     = "owasp/modsecurity-crs:nginx-alpine"
+	defaultWAFRulesPath = "/opt/owasp-crs"
+	wafConfigFileName   = "modsecurity.conf"
+	wafModulePath       = "modules/ngx_http_modsecurity_module.so"
+	// wafHealthCheckRuleID 健康检查路径关闭规则引擎的规则 ID 起始值, 使用 CRS 保留给用户的 1-99999 区间
+	wafHealthCheckRuleID = 1000
+	// wafExclusionRuleID 按路径关闭规则的规则 ID 起始值
+	wafExclusionRuleID = 1100
+	// wafBaseConfig 与 ModSecurity 推荐配置一致, 审计日志以 JSON 格式输出到容器标准输出
+	wafBaseConfig = `SecRuleEngine %s
+SecRequestBodyAccess On
+SecRequestBodyLimit 13107200
+SecRequestBodyNoFilesLimit 131072
+SecRequestBodyLimitAction ProcessPartial
+SecResponseBodyAccess Off
+SecPcreMatchLimit 100000
+SecPcreMatchLimitRecursion 100000
+SecTmpDir /tmp
+SecDataDir /tmp
+SecArgumentSeparator &
+SecCookieFormat 0
+SecStatusEngine Off
+SecAuditEngine RelevantOnly
+SecAuditLogRelevantStatus "^(?:5|4(?!04))"
+SecAuditLogParts ABIJDEFHZ
+SecAuditLogType Serial
+SecAuditLogFormat JSON
+SecAuditLog /dev/stdout
+`
+)
+
+// WAFModeAnnotation Pod 模板上记录的 WAF 运行模式, 用于统计已生效的 Pod
+var WAFModeAnnotation = MakeKeyForNginx("waf-mode")
+
+// GetWAFMode 返回 WAF 运行模式, 未配置时为 Off
+func GetWAFMode(n *devopsV1.Nginx) devopsV1.WAFMode {
+	if n.Spec.WAF == nil {
+		return devopsV1.WAFModeOff
+	}
+	if n.Spec.WAF.Mode == "" {
+		return devopsV1.WAFModeDetection
+	}
+	return n.Spec.WAF.Mode
+}
+
+func IsWAFEnabled(n *devopsV1.Nginx) bool {
+	return GetWAFMode(n) != devopsV1.WAFModeOff
+}
+
+// GetWAFParanoiaLevel 返回 CRS paranoia level, 未开启 WAF 时返回 0
+func GetWAFParanoiaLevel(n *devopsV1.Nginx) int32 {
+	if !IsWAFEnabled(n) {
+		return 0
+	}
+	if n.Spec.WAF.ParanoiaLevel == 0 {
+		return 1
+	}
+	return n.Spec.WAF.ParanoiaLevel
+}
+
+func getWAFImage(n *devopsV1.Nginx) string {
+	return NewDefaultStringUtils(n.Spec.WAF.Image, defaultWAFImage).ValueOrDefault()
+}
+
+// getWAFSnippet 在 http 块中开启 ModSecurity, 对所有 server 生效
+func getWAFSnippet() string {
+	return fmt.Sprintf("modsecurity on;\nmodsecurity_rules_file %s/%s;\n", operatorConfigMountPath, wafConfigFileName)
+}
+
+func joinRuleIDs(ids []int32, format string) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, fmt.Sprintf(format, id))
+	}
+	return out
+}
+
+// getWAFConfig 生成 modsecurity.conf, 代替 CRS 的 crs-setup.conf: CRS 变量, 健康检查和按路径的排除规则需要在加载 CRS 之前声明,
+// 全局排除的 SecRuleRemoveById 需要在加载 CRS 之后声明
+func getWAFConfig(n *devopsV1.Nginx) string {
+	waf := n.Spec.WAF
+	engine := "DetectionOnly"
+	if GetWAFMode(n) == devopsV1.WAFModeBlocking {
+		engine = "On"
+	}
+	rulesPath := NewDefaultStringUtils(waf.RulesPath, defaultWAFRulesPath).ValueOrDefault()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, wafBaseConfig, engine)
+	b.WriteString("\n# OWASP CRS\n")
+	fmt.Fprintf(&b, `SecAction "id:900000,phase:1,pass,t:none,nolog,setvar:tx.blocking_paranoia_level=%d"`+"\n", GetWAFParanoiaLevel(n))
+	b.WriteString(`SecAction "id:900990,phase:1,pass,t:none,nolog,setvar:tx.crs_setup_version=400"` + "\n")
+
+	// kubelet 的检查不经过 WAF, 避免检查请求被误拦截
+	for i, path := range getHealthCheckPaths(n) {
+		fmt.Fprintf(&b, `SecRule REQUEST_FILENAME "@streq %s" "id:%d,phase:1,pass,t:none,nolog,ctl:ruleEngine=Off"`+"\n",
+			path, wafHealthCheckRuleID+i)
+	}
+
+	var removed []int32
+	id := wafExclusionRuleID
+	for _, exclusion := range waf.Exclusions {
+		if len(exclusion.Paths) == 0 {
+			removed = append(removed, exclusion.RuleIDs...)
+			continue
+		}
+		ctl := strings.Join(joinRuleIDs(exclusion.RuleIDs, "ctl:ruleRemoveById=%d"), ",")
+		for _, path := range exclusion.Paths {
+			fmt.Fprintf(&b, `SecRule REQUEST_FILENAME "@beginsWith %s" "id:%d,phase:1,pass,t:none,nolog,%s"`+"\n", path, id, ctl)
+			id++
+		}
+	}
+
+	fmt.Fprintf(&b, "Include %s/rules/*.conf\n", rulesPath)
+	if len(removed) > 0 {
+		fmt.Fprintf(&b, "SecRuleRemoveById %s\n", strings.Join(joinRuleIDs(removed, "%d"), " "))
+	}
+	return b.String()
+}
+
+// loadWAFModule 开启 WAF 时在 Inline 配置开头加载 ModSecurity 模块, 已经加载时不重复添加
+func loadWAFModule(n *devopsV1.Nginx, conf string) string {
+	if !IsWAFEnabled(n) || strings.Contains(conf, "ngx_http_modsecurity_module") {
+		return conf
+	}
+	return fmt.Sprintf("load_module %s;\n%s", wafModulePath, conf)
+}
+
+// setWAF 在 Pod 模板上记录 WAF 运行模式, modsecurity.conf 变化时由生成配置的校验和触发滚动更新
+func setWAF(n *devopsV1.Nginx, template *coreV1.PodTemplateSpec) {
+	if !IsWAFEnabled(n) {
+		return
+	}
+	if template.Annotations == nil {
+		template.Annotations = make(map[string]string)
+	}
+	template.Annotations[WAFModeAnnotation] = string(GetWAFMode(n))
+}
+
+// isValidWAFPath 路径直接写入 SecRule 的参数, 不能包含空白和引号
+func isValidWAFPath(path string) bool {
+	return strings.HasPrefix(path, "/") && !strings.ContainsAny(path, " \t\r\n\"\\")
+}
+
+// ValidateWAF 校验 spec.waf
+func ValidateWAF(n *devopsV1.Nginx) error {
+	if n.Spec.WAF == nil {
+		return nil
+	}
+	// 开启 WAF 时健康检查和探针路径同样写入 modsecurity.conf
+	if IsWAFEnabled(n) {
+		for _, path := range getHealthCheckPaths(n) {
+			if !isValidWAFPath(path) {
+				return fmt.Errorf("spec.waf: health check path %q must start with / and contain no whitespace, quotes or backslashes", path)
+			}
+		}
+	}
+	for i, exclusion := range n.Spec.WAF.Exclusions {
+		field := fmt.Sprintf("spec.waf.exclusions[%d]", i)
+		if len(exclusion.RuleIDs) == 0 {
+			return fmt.Errorf("%s.ruleIDs: required", field)
+		}
+		for _, id := range exclusion.RuleIDs {
+			if id <= 0 {
+				return fmt.Errorf("%s.ruleIDs: invalid rule id %d", field, id)
+			}
+		}
+		for _, path := range exclusion.Paths {
+			if !isValidWAFPath(path) {
+				return fmt.Errorf("%s.paths: %q must start with / and contain no whitespace, quotes or backslashes", field, path)
+			}
+		}
+	}
+	return nil
+}